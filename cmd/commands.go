@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"groupie-tracker/internal/api"
+	"groupie-tracker/internal/changes"
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/export"
+	"groupie-tracker/internal/geo"
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/storage"
+)
+
+// isoLayout is the date format of the -from and -to flags
+const isoLayout = "2006-01-02"
+
+// printJSON writes v as indented JSON
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// searchCommand lists the artists matching a query, like the search page
+func searchCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("search", stderr)
+	loader := config.NewLoader(fs)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(positional, " ")
+	if query == "" {
+		return usageError("missing search query")
+	}
+
+	if _, err := loadConfig(loader); err != nil {
+		return err
+	}
+
+	results, err := api.SearchArtists(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if results == nil {
+			results = []models.Artist{}
+		}
+		return printJSON(stdout, results)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCREATED\tFIRST ALBUM\tMEMBERS")
+	for _, artist := range results {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", artist.ID, artist.Name, artist.CreationDate, models.ISODate(artist.FirstAlbum), strings.Join(artist.Members, ", "))
+	}
+	return tw.Flush()
+}
+
+// artistCommand shows one artist with their concerts
+func artistCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("artist", stderr)
+	loader := config.NewLoader(fs)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("expected one artist ID")
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return usageError(fmt.Sprintf("invalid artist ID %q", positional[0]))
+	}
+
+	if _, err := loadConfig(loader); err != nil {
+		return err
+	}
+
+	artist, found, err := api.ArtistByID(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("artist %d not found", id)
+	}
+
+	relations, err := api.FetchRelations(context.Background())
+	if err != nil {
+		return err
+	}
+	concerts := []models.Concert{}
+	for _, relation := range relations {
+		if relation.ID == id {
+			concerts = relation.Concerts()
+			geo.Locate(concerts)
+		}
+	}
+
+	if *asJSON {
+		return printJSON(stdout, struct {
+			Artist   models.Artist    `json:"artist"`
+			Concerts []models.Concert `json:"concerts"`
+		}{artist, concerts})
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s (ID %d)\n", artist.Name, artist.ID)
+	fmt.Fprintf(tw, "Created:\t%d\n", artist.CreationDate)
+	fmt.Fprintf(tw, "First album:\t%s\n", models.ISODate(artist.FirstAlbum))
+	fmt.Fprintf(tw, "Members:\t%s\n", strings.Join(artist.Members, ", "))
+	if len(artist.Aliases) > 0 {
+		fmt.Fprintf(tw, "Aliases:\t%s\n", strings.Join(artist.Aliases, ", "))
+	}
+	fmt.Fprintf(tw, "\nDATE\tCITY\tCOUNTRY\n")
+	for _, concert := range concerts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", models.ISODate(concert.Date), concert.City, concert.Country)
+	}
+	return tw.Flush()
+}
+
+// concertsCommand lists all concerts in date order, optionally limited to a
+// date range and a location
+func concertsCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("concerts", stderr)
+	loader := config.NewLoader(fs)
+	fromStr := fs.String("from", "", "only concerts on or after this date (yyyy-mm-dd)")
+	toStr := fs.String("to", "", "only concerts on or before this date (yyyy-mm-dd)")
+	location := fs.String("location", "", "only concerts whose location contains this text")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usageError("concerts takes no arguments")
+	}
+
+	var from, to time.Time
+	if *fromStr != "" {
+		if from, err = time.Parse(isoLayout, *fromStr); err != nil {
+			return usageError("-from must look like 2024-01-31")
+		}
+	}
+	if *toStr != "" {
+		if to, err = time.Parse(isoLayout, *toStr); err != nil {
+			return usageError("-to must look like 2024-01-31")
+		}
+	}
+	locationQuery := strings.ToLower(strings.TrimSpace(*location))
+
+	if _, err := loadConfig(loader); err != nil {
+		return err
+	}
+
+	artists, err := api.FetchArtists(context.Background())
+	if err != nil {
+		return err
+	}
+	relations, err := api.FetchRelations(context.Background())
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, artist := range artists {
+		names[artist.ID] = artist.Name
+	}
+
+	var concerts []models.Concert
+	for _, relation := range relations {
+		for _, concert := range relation.Concerts() {
+			date, err := models.ParseConcertDate(concert.Date)
+			if err != nil {
+				continue
+			}
+			if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && date.After(to)) {
+				continue
+			}
+			if locationQuery != "" && !strings.Contains(strings.ToLower(concert.Location), locationQuery) {
+				continue
+			}
+			concerts = append(concerts, concert)
+		}
+	}
+	models.SortConcerts(concerts)
+
+	if *asJSON {
+		type row struct {
+			Artist string `json:"artist"`
+			models.Concert
+		}
+		rows := []row{}
+		for _, concert := range concerts {
+			rows = append(rows, row{names[concert.ArtistID], concert})
+		}
+		return printJSON(stdout, rows)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tARTIST\tCITY\tCOUNTRY")
+	for _, concert := range concerts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", models.ISODate(concert.Date), names[concert.ArtistID], concert.City, concert.Country)
+	}
+	return tw.Flush()
+}
+
+// exportCommand writes the same exports as /export/
+func exportCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("export", stderr)
+	loader := config.NewLoader(fs)
+	format := fs.String("format", "csv", "csv, jsonl or xlsx")
+	dataset := fs.String("dataset", "concerts", "artists or concerts")
+	query := fs.String("q", "", "only artists matching this search query")
+	output := fs.String("o", "", "write to this file instead of standard output")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usageError("export takes no arguments")
+	}
+	if export.ContentType(*format) == "" {
+		return usageError(fmt.Sprintf("unknown format %q, use csv, jsonl or xlsx", *format))
+	}
+	if _, ok := export.Datasets[*dataset]; !ok {
+		return usageError(fmt.Sprintf("unknown dataset %q, use artists or concerts", *dataset))
+	}
+
+	if _, err := loadConfig(loader); err != nil {
+		return err
+	}
+
+	var artists []models.Artist
+	if *query != "" {
+		artists, err = api.SearchArtists(context.Background(), *query)
+	} else {
+		artists, err = api.FetchArtists(context.Background())
+	}
+	if err != nil {
+		return err
+	}
+	relations, err := api.FetchRelations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return export.Write(stdout, *dataset, *format, artists, relations)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := export.Write(f, *dataset, *format, artists, relations); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// snapshotCommand writes the current upstream data in the format of the
+// server's snapshot.json, or the changes since a previous snapshot
+func snapshotCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("snapshot", stderr)
+	loader := config.NewLoader(fs)
+	output := fs.String("o", "", "write to this file instead of standard output")
+	diff := fs.String("diff", "", "print the changes since this snapshot file instead")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usageError("snapshot takes no arguments")
+	}
+
+	if _, err := loadConfig(loader); err != nil {
+		return err
+	}
+
+	if _, err := api.FetchArtists(context.Background()); err != nil {
+		return err
+	}
+	if _, err := api.FetchRelations(context.Background()); err != nil {
+		return err
+	}
+	snapshot := api.CurrentSnapshot()
+
+	var result interface{} = snapshot
+	if *diff != "" {
+		var previous models.Snapshot
+		found, err := storage.ReadJSON(*diff, &previous)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("snapshot %s does not exist", *diff)
+		}
+		result = changes.Diff(previous, snapshot)
+	}
+
+	if *output != "" {
+		return storage.WriteJSON(*output, result)
+	}
+	return printJSON(stdout, result)
+}
+
+// problem is something wrong in the upstream data
+type problem struct {
+	Severity string `json:"severity"` // error or warning
+	ArtistID int    `json:"artistId,omitempty"`
+	Message  string `json:"message"`
+}
+
+// validateCommand checks the upstream data and fails if it finds errors
+func validateCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", stderr)
+	loader := config.NewLoader(fs)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usageError("validate takes no arguments")
+	}
+
+	if _, err := loadConfig(loader); err != nil {
+		return err
+	}
+
+	artists, err := api.FetchArtists(context.Background())
+	if err != nil {
+		return err
+	}
+	relations, err := api.FetchRelations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	problems, concertCount := validateData(artists, relations)
+	errorCount := 0
+	for _, p := range problems {
+		if p.Severity == "error" {
+			errorCount++
+		}
+	}
+
+	if *asJSON {
+		if problems == nil {
+			problems = []problem{}
+		}
+		err = printJSON(stdout, struct {
+			Artists  int       `json:"artists"`
+			Concerts int       `json:"concerts"`
+			Problems []problem `json:"problems"`
+		}{len(artists), concertCount, problems})
+	} else {
+		for _, p := range problems {
+			if p.ArtistID != 0 {
+				fmt.Fprintf(stdout, "%s: artist %d: %s\n", p.Severity, p.ArtistID, p.Message)
+			} else {
+				fmt.Fprintf(stdout, "%s: %s\n", p.Severity, p.Message)
+			}
+		}
+		fmt.Fprintf(stdout, "%d artists, %d concerts: %d errors, %d warnings\n",
+			len(artists), concertCount, errorCount, len(problems)-errorCount)
+	}
+	if err != nil {
+		return err
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("%d errors found", errorCount)
+	}
+	return nil
+}
+
+// validateData returns the problems found in the artists and relations and
+// the number of concerts
+func validateData(artists []models.Artist, relations []models.Relation) ([]problem, int) {
+	var problems []problem
+	report := func(severity string, artistID int, format string, args ...interface{}) {
+		problems = append(problems, problem{severity, artistID, fmt.Sprintf(format, args...)})
+	}
+
+	currentYear := time.Now().Year()
+	known := make(map[int]bool)
+	for _, artist := range artists {
+		if err := artist.Validate(); err != nil {
+			report("error", artist.ID, "%v", err)
+		}
+		if known[artist.ID] {
+			report("error", artist.ID, "duplicate artist ID")
+		}
+		known[artist.ID] = true
+
+		if artist.CreationDate < 1900 || artist.CreationDate > currentYear {
+			report("warning", artist.ID, "unlikely creation date %d", artist.CreationDate)
+		}
+		album, err := models.ParseConcertDate(artist.FirstAlbum)
+		if err != nil {
+			report("error", artist.ID, "invalid first album date %q", artist.FirstAlbum)
+		} else if album.Year() < artist.CreationDate {
+			report("warning", artist.ID, "first album (%d) before creation (%d)", album.Year(), artist.CreationDate)
+		}
+		if len(artist.Members) == 0 {
+			report("warning", artist.ID, "no members")
+		}
+	}
+
+	concertCount := 0
+	hasRelation := make(map[int]bool)
+	unlocated := make(map[string]bool)
+	for _, relation := range relations {
+		if !known[relation.ID] {
+			report("error", relation.ID, "concerts for an unknown artist")
+		}
+		hasRelation[relation.ID] = true
+		for _, concert := range relation.Concerts() {
+			concertCount++
+			if _, err := models.ParseConcertDate(concert.Date); err != nil {
+				report("error", relation.ID, "invalid concert date %q in %s", concert.Date, concert.Location)
+			}
+			if unlocated[concert.Location] {
+				continue
+			}
+			if _, ok := geo.Lookup(concert.Location); !ok {
+				unlocated[concert.Location] = true
+				report("warning", 0, "no coordinates for location %q", concert.Location)
+			}
+		}
+	}
+	for _, artist := range artists {
+		if !hasRelation[artist.ID] {
+			report("warning", artist.ID, "no concert data")
+		}
+	}
+	return problems, concertCount
+}
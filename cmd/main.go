@@ -1,70 +1,163 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
-	"groupie-tracker/internal/handlers"
+	"groupie-tracker/internal/api"
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/geo"
+	"groupie-tracker/internal/logging"
 )
 
-func checkRequiredDirs() {
-	requiredDirs := []string{"static", "internal/templates"}
+// command runs a subcommand with its arguments
+type command func(args []string, stdout, stderr io.Writer) error
 
-	for _, dir := range requiredDirs {
-		info, err := os.Stat(dir)
-		if os.IsNotExist(err) || !info.IsDir() {
-			log.Fatalf("ERROR: Required folder '%s' is missing or not a directory.\n", dir)
-		}
-		checkFolderNotEmpty(dir)
+var commands = map[string]command{
+	"serve":    serve,
+	"search":   searchCommand,
+	"artist":   artistCommand,
+	"concerts": concertsCommand,
+	"export":   exportCommand,
+	"snapshot": snapshotCommand,
+	"validate": validateCommand,
+	"config":   configCommand,
+}
+
+const usage = `Usage: groupie-tracker [command] [flags]
+
+Commands:
+  serve                          Start the web server (default)
+  search <query>                 List artists matching a query
+  artist <id>                    Show an artist and their concerts
+  concerts [-from] [-to]         List concerts, optionally between two dates (yyyy-mm-dd)
+  export -format csv|jsonl|xlsx  Write the artists or concerts export
+  snapshot [-o file]             Write the current upstream data as JSON
+  validate                       Check the upstream data for problems
+  config print                   Show the effective configuration and where each setting comes from
+
+Every command accepts -config <file> and the flags of "config print -h".
+Settings come from, in increasing precedence: defaults, the config file,
+environment variables and flags.
+
+Run "groupie-tracker <command> -h" for the flags of a command.
+Exit status is 1 when the upstream API fails or validation finds errors, 2 on usage errors.
+`
+
+// usageError is a mistake in the command line
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// errFlags means the flag set has already reported a bad flag
+var errFlags = errors.New("invalid flags")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit status
+func run(args []string, stdout, stderr io.Writer) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || (len(args) > 0 && name == "serve" && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help")) {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+
+	err := cmd(args, stdout, stderr)
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errFlags):
+		return 2
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return 2
+	default:
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return 1
 	}
 }
 
-func checkFolderNotEmpty(path string) {
-	f, err := os.Open(path)
+// loadConfig loads the configuration and applies the settings every command
+// shares. Configuration problems are usage errors.
+func loadConfig(loader *config.Loader) (*config.Config, error) {
+	cfg, err := loader.Load(os.Getenv)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to open '%s': %v", path, err)
+		return nil, usageError(err.Error())
 	}
-	defer f.Close()
 
-	files, err := f.Readdirnames(1)
-	if err != nil || len(files) == 0 {
-		log.Fatalf("ERROR: '%s' folder is empty or unreadable", path)
+	if err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		return nil, usageError(err.Error())
+	}
+	api.SetBaseURL(cfg.Upstream.URL)
+	api.SetCacheTTL(cfg.Cache.TTL)
+	if err := api.SetAliasFile(cfg.Paths.Aliases); err != nil {
+		return nil, usageError(fmt.Sprintf("alias file %s: %v", cfg.Paths.Aliases, err))
 	}
+	if err := geo.SetOverridesFile(cfg.Paths.GeoOverrides); err != nil {
+		return nil, usageError(fmt.Sprintf("geo override file %s: %v", cfg.Paths.GeoOverrides, err))
+	}
+	return cfg, nil
 }
 
-func main() {
-	// security measures
-	checkRequiredDirs()
-
-	// Initialize handlers (templates)
-	log.Println("Initializing handlers")
-	handlers.Init()
-
-	// Setup routes
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", handlers.HomeHandler)
-	mux.HandleFunc("/artist/", handlers.ArtistHandler)
-	mux.HandleFunc("/search", handlers.SearchHandler)
-	mux.HandleFunc("/static/", handlers.StaticHandler)
-	mux.HandleFunc("/api/artists", handlers.APIArtistsHandler)
-	mux.HandleFunc("/api/search/locations", handlers.APILocationSearchHandler)
-	mux.HandleFunc("/api/suggestions/locations", handlers.APILocationSuggestionsHandler)
-	mux.HandleFunc("/api/cache/status", handlers.APICacheStatusHandler)
-	mux.HandleFunc("/api/cache/clear", handlers.APIClearCacheHandler)
-
-	// Get port from environment, default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// configCommand handles "config print", which shows the effective configuration
+func configCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("config", stderr)
+	loader := config.NewLoader(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
 	}
-	if port[0] != ':' {
-		port = ":" + port
+	if len(positional) != 1 || positional[0] != "print" {
+		return usageError(`expected "config print"`)
 	}
 
-	// Start server
-	log.Printf("Server starting on %s", port)
-	if err := http.ListenAndServe(port, mux); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	cfg, err := loader.Load(os.Getenv)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	return cfg.Write(stdout)
+}
+
+// newFlagSet creates the flag set of a command, printing errors and help to stderr
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseArgs parses flags that may appear before or after the positional
+// arguments ("search -json queen" and "search queen -json") and returns the
+// positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return nil, err
+		} else if err != nil {
+			return nil, errFlags
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/handlers"
+	"groupie-tracker/internal/models"
+)
+
+// startUpstream serves a small dataset and points the api package at it
+func startUpstream(t *testing.T) {
+	t.Helper()
+
+	artists := []models.Artist{
+		{ID: 1, Name: "Queen", Members: []string{"Freddie Mercury", "Brian May"}, CreationDate: 1970, FirstAlbum: "13-07-1973"},
+		{ID: 2, Name: "AC/DC", Members: []string{"Angus Young"}, CreationDate: 1973, FirstAlbum: "17-02-1975"},
+	}
+	relations := models.RelationIndex{Index: []models.Relation{
+		{ID: 1, DatesLocations: map[string][]string{"london-uk": {"14-06-1986"}}},
+		{ID: 2, DatesLocations: map[string][]string{"new_york-usa": {"03-08-1988"}, "los_angeles-usa": {"05-08-1988"}}},
+	}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artists", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(artists)
+	})
+	mux.HandleFunc("/relation", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(relations)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("UPSTREAM_URL", server.URL)
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestSearchJSON(t *testing.T) {
+	startUpstream(t)
+
+	code, out, errOut := runCommand("search", "queen", "-json")
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, errOut)
+	}
+	var artists []models.Artist
+	if err := json.Unmarshal([]byte(out), &artists); err != nil {
+		t.Fatal(err)
+	}
+	if len(artists) != 1 || artists[0].Name != "Queen" {
+		t.Errorf("search found %+v, want Queen", artists)
+	}
+}
+
+func TestConcertsDateRange(t *testing.T) {
+	startUpstream(t)
+
+	code, out, errOut := runCommand("concerts", "-from", "1988-01-01", "--to", "1988-08-04")
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, errOut)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "1988-08-03") || !strings.Contains(lines[1], "New York") {
+		t.Errorf("concerts printed:\n%s\nwant only the New York show", out)
+	}
+}
+
+func TestArtistNotFound(t *testing.T) {
+	startUpstream(t)
+
+	if code, _, errOut := runCommand("artist", "99"); code != 1 || !strings.Contains(errOut, "not found") {
+		t.Errorf("exit status %d (%q), want 1 with not found", code, errOut)
+	}
+	if code, _, _ := runCommand("artist", "abc"); code != 2 {
+		t.Errorf("invalid ID: exit status %d, want 2", code)
+	}
+}
+
+func TestUpstreamErrorExitStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+	t.Setenv("UPSTREAM_URL", server.URL)
+
+	if code, _, _ := runCommand("search", "queen"); code != 1 {
+		t.Errorf("exit status %d, want 1 when the upstream fails", code)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"frobnicate"},
+		{"search"},
+		{"concerts", "-from", "yesterday"},
+		{"export", "-format", "pdf"},
+		{"validate", "-nope"},
+		{"search", "queen", "-port", "99999"},
+		{"config", "print", "-cache-ttl", "soon"},
+	} {
+		if code, _, _ := runCommand(args...); code != 2 {
+			t.Errorf("%v: exit status %d, want 2", args, code)
+		}
+	}
+}
+
+func TestValidateData(t *testing.T) {
+	artists := []models.Artist{
+		{ID: 1, Name: "Queen", Members: []string{"Freddie Mercury"}, CreationDate: 1970, FirstAlbum: "13-07-1973"},
+		{ID: 2, Name: "", Members: []string{"Angus Young"}, CreationDate: 1973, FirstAlbum: "1975"},
+	}
+	relations := []models.Relation{
+		{ID: 1, DatesLocations: map[string][]string{"london-uk": {"14-06-1986"}}},
+		{ID: 3, DatesLocations: map[string][]string{"london-uk": {"31-02-1990"}}},
+	}
+
+	problems, concerts := validateData(artists, relations)
+	if concerts != 2 {
+		t.Errorf("counted %d concerts, want 2", concerts)
+	}
+	var errors []string
+	for _, p := range problems {
+		if p.Severity == "error" {
+			errors = append(errors, p.Message)
+		}
+	}
+	want := []string{"artist name cannot be empty", `invalid first album date "1975"`, "concerts for an unknown artist", `invalid concert date "31-02-1990" in London Uk`}
+	if strings.Join(errors, "|") != strings.Join(want, "|") {
+		t.Errorf("errors = %q, want %q", errors, want)
+	}
+}
+
+func TestSecurityHeadersOnEveryRoute(t *testing.T) {
+	startUpstream(t)
+	cfg, err := loadConfig(config.NewLoader(newFlagSet("test", io.Discard)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.Init(cfg, handlers.EmbeddedAssets())
+	handler := routes()
+
+	paths := []string{
+		"/", "/artist/queen", "/artist/1", "/artist/queen/", "/artist/queen/concerts", "/artist/queen/concerts.ics",
+		"/search?q=queen", "/concerts.ics", "/export/artists.csv", "/static/css/app.css", "/changes",
+		"/feeds/artists.atom", "/feeds/concerts.rss", "/metrics", "/healthz", "/readyz", "/api/artists", "/api/artists/1/timeline",
+		"/api/locations", "/api/concerts/near?lat=51.5&lon=0", "/api/search/locations?q=london",
+		"/api/suggestions/locations?q=lon", "/api/changes", "/api/cache/status", "/admin/cache",
+		"/admin/cache/clear", "/admin/cache/refresh", "/admin/cache/artists/1/invalidate", "/admin/webhooks/deliveries", "/nope", "/api/nope",
+	}
+	for _, path := range paths {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+			for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Permissions-Policy"} {
+				if rec.Header().Get(header) == "" {
+					t.Errorf("%s %s (%d): no %s header", method, path, rec.Code, header)
+				}
+			}
+			policy := rec.Header().Get("Content-Security-Policy")
+			if !strings.Contains(policy, "script-src 'self' 'nonce-") || !strings.Contains(policy, "img-src 'self' data: http://127.0.0.1") {
+				t.Errorf("%s %s (%d): Content-Security-Policy = %q", method, path, rec.Code, policy)
+			}
+		}
+	}
+
+	// The error page's inline script carries the nonce of its own response
+	first, second := httptest.NewRecorder(), httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	nonce := func(rec *httptest.ResponseRecorder) string {
+		_, nonce, _ := strings.Cut(rec.Header().Get("Content-Security-Policy"), "'nonce-")
+		nonce, _, _ = strings.Cut(nonce, "'")
+		return nonce
+	}
+	if nonce(first) == "" || nonce(first) == nonce(second) {
+		t.Errorf("nonces %q and %q, want a different one per response", nonce(first), nonce(second))
+	}
+	if !strings.Contains(first.Body.String(), `<script nonce="`+nonce(first)+`">`) {
+		t.Errorf("error page script does not carry the nonce %q", nonce(first))
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"groupie-tracker/internal/api"
+	"groupie-tracker/internal/changes"
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/feeds"
+	"groupie-tracker/internal/handlers"
+	"groupie-tracker/internal/webhooks"
+)
+
+// Server limits. The write timeout leaves room for exports of the whole
+// dataset.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 120 * time.Second
+	maxHeaderBytes    = 64 << 10
+)
+
+// fatal logs an error that keeps the server from starting and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func checkRequiredDirs(requiredDirs ...string) {
+	for _, dir := range requiredDirs {
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) || !info.IsDir() {
+			fatal("Required folder is missing or not a directory", "path", dir)
+		}
+		checkFolderNotEmpty(dir)
+	}
+}
+
+// requiredAssets are the files the server cannot run without, relative to
+// the templates and static roots
+var requiredAssets = struct{ templates, static []string }{
+	templates: []string{"index.html", "artist.html", "changes.html", "error.html"},
+	static:    []string{"css/app.css", "js/search.js"},
+}
+
+// checkAssets makes sure the active asset source has every required file
+func checkAssets(assets handlers.Assets) {
+	check := func(fsys fs.FS, names []string) {
+		for _, name := range names {
+			if _, err := fs.Stat(fsys, name); err != nil {
+				fatal("Required file is missing", "file", name, "source", assets.Source, "err", err)
+			}
+		}
+	}
+	check(assets.Templates, requiredAssets.templates)
+	check(assets.Static, requiredAssets.static)
+}
+
+func checkFolderNotEmpty(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		fatal("Opening folder failed", "path", path, "err", err)
+	}
+	defer f.Close()
+
+	files, err := f.Readdirnames(1)
+	if err != nil || len(files) == 0 {
+		fatal("Folder is empty or unreadable", "path", path)
+	}
+}
+
+// serve starts the web server
+func serve(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("serve", stderr)
+	loader := config.NewLoader(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usageError("serve takes no arguments")
+	}
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	// Templates and static files are built in; dev mode reads them from disk
+	// so edits show up without rebuilding
+	assets := handlers.EmbeddedAssets()
+	if cfg.Server.Dev {
+		checkRequiredDirs(cfg.Paths.Static, cfg.Paths.Templates)
+		assets = handlers.DiskAssets(cfg.Paths.Templates, cfg.Paths.Static)
+	}
+	checkAssets(assets)
+
+	// Initialize handlers (templates)
+	slog.Info("Initializing handlers")
+	handlers.Init(cfg, assets)
+	if !cfg.Admin.Enabled() {
+		slog.Warn("No admin credentials configured, the /admin/ endpoints refuse every request")
+	}
+	stopWatching := make(chan struct{})
+	if cfg.Server.Dev {
+		slog.Info("Dev mode: reloading templates when they change", "path", cfg.Paths.Templates)
+		go handlers.WatchTemplates(time.Second, stopWatching)
+	}
+
+	// Track upstream changes for the feeds, persisted in the data directory
+	dataDir := cfg.Paths.Data
+	if err := changes.Init(dataDir); err != nil {
+		fatal("Loading snapshot failed", "path", dataDir, "err", err)
+	}
+	if err := feeds.Init(dataDir); err != nil {
+		fatal("Loading feeds failed", "path", dataDir, "err", err)
+	}
+	if err := webhooks.Init(cfg.Paths.Webhooks, dataDir); err != nil {
+		fatal("Loading webhooks failed", "err", err)
+	}
+	changes.Subscribe(feeds.Record)
+	changes.Subscribe(webhooks.Dispatch)
+	stopTracker := changes.Start()
+	api.OnRefresh(changes.Observe)
+
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           routes(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+
+	// Keep the caches fresh so changes are noticed without traffic
+	stopRefresher := api.StartRefresher(cfg.Cache.TTL)
+
+	// Stop background work once no more requests can trigger it: the
+	// refresher first, since a refresh can record changes, then the change
+	// tracker, since publishing a change dispatches webhooks
+	defer func() {
+		close(stopWatching)
+		stopRefresher()
+		stopTracker()
+		webhooks.Stop()
+	}()
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Start server
+	slog.Info("Server starting", "addr", server.Addr)
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-signals.Done():
+	}
+
+	// Let in-flight requests finish, then close whatever is left
+	slog.Info("Shutting down, waiting for requests to finish", "timeout", cfg.Server.ShutdownTimeout)
+	stopSignals() // a second signal kills the process
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// routes returns the handler of every route, with the security headers and
+// request logging
+func routes() http.Handler {
+	get, post := http.MethodGet, http.MethodPost
+	searchLimit := func(h http.HandlerFunc) http.HandlerFunc { return handlers.RateLimit(handlers.SearchGroup, h) }
+	apiLimit := func(h http.HandlerFunc) http.HandlerFunc { return handlers.RateLimit(handlers.APIGroup, h) }
+	router := handlers.NewRouter()
+	router.Page(get, "/{$}", handlers.HomeHandler)
+	router.Page(get, "/artist/{ref}", handlers.ArtistHandler)
+	router.Page(get, "/artist/{ref}/{$}", handlers.TrailingSlashHandler)
+	router.Page(get, "/artist/{ref}/concerts", handlers.ArtistConcertsHandler)
+	router.Page(get, "/artist/{ref}/concerts.ics", handlers.ArtistCalendarHandler)
+	router.Page(get, "/search", searchLimit(handlers.SearchHandler))
+	router.Page(get, "/concerts.ics", handlers.ConcertsCalendarHandler)
+	router.Page(get, "/export/", handlers.ExportHandler)
+	router.Page(get, "/static/", handlers.StaticHandler)
+	router.Page(get, "/changes", handlers.ChangesHandler)
+	router.Page(get, "/feeds/artists.atom", handlers.FeedArtistsAtomHandler)
+	router.Page(get, "/feeds/concerts.rss", handlers.FeedConcertsRSSHandler)
+	router.Page(get, "/metrics", handlers.MetricsHandler)
+	router.API(get, "/healthz", handlers.HealthzHandler)
+	router.API(get, "/readyz", handlers.ReadyzHandler)
+	router.API(get, "/api/artists", apiLimit(handlers.APIArtistsHandler))
+	router.API(get, "/api/artists/", apiLimit(handlers.APIArtistResourceHandler))
+	router.API(get, "/api/locations", apiLimit(handlers.APILocationsHandler))
+	router.API(get, "/api/concerts/near", apiLimit(handlers.APIConcertsNearHandler))
+	router.API(get, "/api/search/locations", searchLimit(handlers.APILocationSearchHandler))
+	router.API(get, "/api/suggestions/locations", searchLimit(handlers.APILocationSuggestionsHandler))
+	router.API(get, "/api/changes", apiLimit(handlers.APIChangesHandler))
+	router.API(get, "/api/cache/status", apiLimit(handlers.APICacheStatusHandler))
+	router.API(get, "/admin/cache", handlers.AdminHandler(handlers.AdminCacheHandler))
+	router.API(post, "/admin/cache/clear", handlers.AdminHandler(handlers.AdminClearCacheHandler))
+	router.API(post, "/admin/cache/refresh", handlers.AdminHandler(handlers.AdminRefreshCacheHandler))
+	router.API(post, "/admin/cache/{name}/invalidate", handlers.AdminHandler(handlers.AdminInvalidateCacheHandler))
+	router.API(post, "/admin/cache/artists/{id}/invalidate", handlers.AdminHandler(handlers.AdminInvalidateArtistHandler))
+	router.API(get, "/admin/webhooks/deliveries", handlers.AdminHandler(handlers.AdminWebhookDeliveriesHandler))
+	return handlers.LogRequests(handlers.SecurityHeaders(router))
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// Aliases maps synonyms to canonical location and artist names.
+// Location values are cleaned location names (or parts of them, like a
+// country), artist values are artist names as returned by the upstream API.
+type Aliases struct {
+	Locations map[string]string `json:"locations"`
+	Artists   map[string]string `json:"artists"`
+}
+
+// Cache structure for the alias file
+type AliasStore struct {
+	path      string
+	modTime   time.Time
+	checked   time.Time
+	locations map[string]string   // lowercased alias -> lowercased canonical location
+	artists   map[string][]string // lowercased artist name -> aliases
+	mutex     sync.RWMutex
+}
+
+var (
+	aliasStore         = &AliasStore{path: defaultAliasFile()}
+	aliasCheckInterval = 2 * time.Second // How often the alias file is checked for changes
+)
+
+// defaultAliasFile returns the alias file used until SetAliasFile is called
+func defaultAliasFile() string {
+	return "aliases.json"
+}
+
+// SetAliasFile changes the alias file and loads it immediately
+func SetAliasFile(path string) error {
+	aliasStore.mutex.Lock()
+	aliasStore.path = path
+	aliasStore.mutex.Unlock()
+	return ReloadAliases()
+}
+
+// ReloadAliases re-reads the alias file and applies it to the cached
+// artists and locations. A missing file means no aliases.
+func ReloadAliases() error {
+	aliasStore.mutex.RLock()
+	path := aliasStore.path
+	aliasStore.mutex.RUnlock()
+
+	var modTime time.Time
+	var aliases Aliases
+	info, err := os.Stat(path)
+	if err == nil {
+		modTime = info.ModTime()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &aliases); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	locations := make(map[string]string)
+	for alias, canonical := range aliases.Locations {
+		locations[normalizeAlias(alias)] = strings.ToLower(models.CleanLocationName(canonical))
+	}
+	artists := make(map[string][]string)
+	for alias, name := range aliases.Artists {
+		key := strings.ToLower(strings.TrimSpace(name))
+		artists[key] = append(artists[key], strings.TrimSpace(alias))
+	}
+	for _, list := range artists {
+		sort.Strings(list)
+	}
+
+	aliasStore.mutex.Lock()
+	aliasStore.locations = locations
+	aliasStore.artists = artists
+	aliasStore.modTime = modTime
+	aliasStore.checked = time.Now()
+	aliasStore.mutex.Unlock()
+
+	resolveAliases()
+	return nil
+}
+
+// refreshAliases reloads the alias file if it changed since the last check
+func refreshAliases() {
+	aliasStore.mutex.RLock()
+	if !aliasStore.checked.IsZero() && time.Since(aliasStore.checked) < aliasCheckInterval {
+		aliasStore.mutex.RUnlock()
+		return
+	}
+	path, modTime, loaded := aliasStore.path, aliasStore.modTime, !aliasStore.checked.IsZero()
+	aliasStore.mutex.RUnlock()
+
+	var current time.Time
+	if info, err := os.Stat(path); err == nil {
+		current = info.ModTime()
+	}
+	if loaded && current.Equal(modTime) {
+		aliasStore.mutex.Lock()
+		aliasStore.checked = time.Now()
+		aliasStore.mutex.Unlock()
+		return
+	}
+
+	if err := ReloadAliases(); err != nil {
+		// Keep the previous aliases, try again after the next interval
+		slog.Error("Loading aliases failed", "path", path, "err", err)
+		aliasStore.mutex.Lock()
+		aliasStore.modTime = current
+		aliasStore.checked = time.Now()
+		aliasStore.mutex.Unlock()
+	}
+}
+
+// normalizeAlias makes alias lookups case and separator insensitive
+func normalizeAlias(s string) string {
+	return strings.ToLower(models.CleanLocationName(s))
+}
+
+// resolveAliases applies the current aliases to the cached artists and
+// rebuilds the location alias index. It must not be called with a cache
+// lock held.
+func resolveAliases() {
+	artistCache.mutex.Lock()
+	artists := make([]models.Artist, len(artistCache.artists))
+	copy(artists, artistCache.artists)
+	resolveArtistAliases(artists)
+	artistCache.artists = artists // same order, the indexes still hold
+	artistCache.mutex.Unlock()
+
+	locationCache.mutex.Lock()
+	locationCache.aliases = buildAliasIndex(locationCache.locations)
+	locationCache.mutex.Unlock()
+}
+
+// resolveArtistAliases attaches the configured aliases to each artist
+func resolveArtistAliases(artists []models.Artist) {
+	aliasStore.mutex.RLock()
+	defer aliasStore.mutex.RUnlock()
+
+	for i := range artists {
+		artists[i].Aliases = aliasStore.artists[strings.ToLower(artists[i].Name)]
+	}
+}
+
+// buildAliasIndex maps each location alias to the cleaned locations its
+// canonical name matches as whole words, so "Uk" names "London Uk" but
+// neither "Milwaukee Usa" nor "Kiev Ukraine"
+func buildAliasIndex(locations map[string][]int) map[string][]string {
+	aliasStore.mutex.RLock()
+	defer aliasStore.mutex.RUnlock()
+
+	index := make(map[string][]string)
+	for alias, canonical := range aliasStore.locations {
+		for location := range locations {
+			if containsWords(strings.ToLower(location), canonical) {
+				index[alias] = append(index[alias], location)
+			}
+		}
+		sort.Strings(index[alias])
+	}
+	return index
+}
+
+// containsWords reports whether the words of phrase appear in text next to
+// each other and in order
+func containsWords(text, phrase string) bool {
+	words, want := strings.Fields(text), strings.Fields(phrase)
+	if len(want) == 0 {
+		return false
+	}
+	for i := 0; i+len(want) <= len(words); i++ {
+		match := true
+		for j := range want {
+			if words[i+j] != want[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasedLocations returns the locations named by a query that is exactly
+// an alias
+func aliasedLocations(query string) map[string]bool {
+	locationCache.mutex.RLock()
+	defer locationCache.mutex.RUnlock()
+
+	named := make(map[string]bool)
+	for _, location := range locationCache.aliases[normalizeAlias(query)] {
+		named[location] = true
+	}
+	return named
+}
+
+// aliasSuggestions returns the locations named by aliases starting with the
+// query, sorted
+func aliasSuggestions(query string) []string {
+	prefix := normalizeAlias(query)
+	if prefix == "" {
+		return nil
+	}
+
+	locationCache.mutex.RLock()
+	defer locationCache.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var suggestions []string
+	for alias, locations := range locationCache.aliases {
+		if !strings.HasPrefix(alias, prefix) {
+			continue
+		}
+		for _, location := range locations {
+			if !seen[location] {
+				suggestions = append(suggestions, location)
+				seen[location] = true
+			}
+		}
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
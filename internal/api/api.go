@@ -1,129 +1,448 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"groupie-tracker/internal/geo"
+	"groupie-tracker/internal/logging"
 	"groupie-tracker/internal/models"
+	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-const baseURL = "https://groupietrackers.herokuapp.com/api"
+var baseURL = "https://groupietrackers.herokuapp.com/api"
+
+// client fetches from the upstream API; the timeout keeps a hung upstream
+// from blocking requests and the background refresher forever
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// StatusError is returned for an upstream answer that is not a 2xx
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("upstream answered %d %s for %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+}
+
+// getJSON fetches an upstream URL and decodes its JSON body into v. The
+// request ID of ctx is passed upstream and logged with the call, which is
+// counted in the upstream metrics. Answers other than 2xx are a StatusError
+// and are not decoded; they and failed connections count towards opening
+// the breaker.
+func getJSON(ctx context.Context, url string, v interface{}) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if !upstreamBreaker.allow(time.Now()) {
+		return ErrUpstreamUnavailable
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	name := endpoint(url)
+	start := time.Now()
+	status := 0
+	defer func() {
+		if ctx.Err() != nil {
+			upstreamBreaker.release()
+		} else {
+			upstreamBreaker.record(status < 200 || status > 299, time.Now())
+		}
+		upstreamRequests.Inc(name, strconv.Itoa(status))
+		upstreamDuration.Observe(time.Since(start).Seconds(), name)
+		if err != nil {
+			upstreamErrors.Inc(name, strconv.Itoa(status))
+		}
+	}()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.WarnContext(ctx, "Upstream request failed", "url", url, "duration", time.Since(start), "err", err)
+		return err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	slog.InfoContext(ctx, "Upstream request", "url", url, "status", resp.StatusCode, "duration", time.Since(start))
+	if status < 200 || status > 299 {
+		return &StatusError{URL: url, StatusCode: status}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// SetCacheTTL changes how long upstream data is cached
+func SetCacheTTL(ttl time.Duration) {
+	cacheTTL = ttl
+}
+
+// SetBaseURL changes the upstream API root, clears the caches and closes
+// the breaker. Call it before serving requests.
+func SetBaseURL(url string) {
+	baseURL = strings.TrimSuffix(url, "/")
+	ClearCache()
+	upstreamBreaker.reset()
+}
 
 // Cache structure for artists data
 type ArtistCache struct {
 	artists    []models.Artist
+	byID       map[int]int    // artist ID -> index in artists
+	bySlug     map[string]int // slug -> index in artists, rebuilt on every fetch
 	lastUpdate time.Time
+	stats      cacheStats
 	mutex      sync.RWMutex
 }
 
 // Cache structure for locations data
 type LocationCache struct {
-	locations  map[string][]int // location name -> artist IDs
+	locations  map[string][]int    // location name -> artist IDs
+	relations  []models.Relation   // raw relation data, one per artist
+	spatial    *geo.Index          // located concerts for radius queries
+	aliases    map[string][]string // normalized alias -> locations it names
 	lastUpdate time.Time
+	stats      cacheStats
 	mutex      sync.RWMutex
 }
 
 var (
-	artistCache   = &ArtistCache{}
+	artistCache   = &ArtistCache{stats: cacheStats{name: ArtistsCache}}
 	locationCache = &LocationCache{
 		locations: make(map[string][]int),
+		stats:     cacheStats{name: LocationsCache},
 	}
 	cacheTTL = 5 * time.Minute // Cache for 5 minutes
+
+	refreshListeners []func(models.Snapshot)
+	listenersMutex   sync.Mutex
+	notifyMutex      sync.Mutex // one notification at a time, in snapshot order
 )
 
+// OnRefresh registers a function called with the current data after every
+// upstream fetch of artists or relations. Listeners are called one refresh
+// at a time and should return quickly.
+func OnRefresh(listener func(models.Snapshot)) {
+	listenersMutex.Lock()
+	refreshListeners = append(refreshListeners, listener)
+	listenersMutex.Unlock()
+}
+
+// notifyRefresh passes the current snapshot to every listener. Refreshes
+// finishing together take turns, so the listeners get their snapshots in
+// the order they were taken and never diff a newer one against an older.
+func notifyRefresh() {
+	listenersMutex.Lock()
+	listeners := make([]func(models.Snapshot), len(refreshListeners))
+	copy(listeners, refreshListeners)
+	listenersMutex.Unlock()
+	if len(listeners) == 0 {
+		return
+	}
+
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	snapshot := CurrentSnapshot()
+	for _, listener := range listeners {
+		listener(snapshot)
+	}
+}
+
+// CurrentSnapshot returns the cached artists and relations without fetching
+func CurrentSnapshot() models.Snapshot {
+	snapshot := models.Snapshot{Time: time.Now()}
+
+	artistCache.mutex.RLock()
+	if !artistCache.lastUpdate.IsZero() {
+		snapshot.Artists = make([]models.Artist, len(artistCache.artists))
+		copy(snapshot.Artists, artistCache.artists)
+	}
+	artistCache.mutex.RUnlock()
+
+	locationCache.mutex.RLock()
+	if !locationCache.lastUpdate.IsZero() {
+		snapshot.Relations = make([]models.Relation, len(locationCache.relations))
+		copy(snapshot.Relations, locationCache.relations)
+	}
+	locationCache.mutex.RUnlock()
+
+	return snapshot
+}
+
 // FetchArtists gets all artists from the API with caching
-func FetchArtists() ([]models.Artist, error) {
+func FetchArtists(ctx context.Context) ([]models.Artist, error) {
+	refreshAliases()
+
 	// Check cache first
 	artistCache.mutex.RLock()
 	if !artistCache.lastUpdate.IsZero() && time.Since(artistCache.lastUpdate) < cacheTTL {
 		artists := make([]models.Artist, len(artistCache.artists))
 		copy(artists, artistCache.artists)
 		artistCache.mutex.RUnlock()
+		artistCache.stats.hit()
 		return artists, nil
 	}
 	artistCache.mutex.RUnlock()
+	artistCache.stats.miss()
 
-	// Fetch fresh data
-	artists, err := fetchArtistsFromAPI()
+	return loadArtists(ctx)
+}
+
+// ArtistByID looks up an artist by ID without scanning the list
+func ArtistByID(ctx context.Context, id int) (models.Artist, bool, error) {
+	return lookupArtist(ctx, func(c *ArtistCache) (int, bool) {
+		i, found := c.byID[id]
+		return i, found
+	})
+}
+
+// ArtistBySlug looks up an artist by their slug
+func ArtistBySlug(ctx context.Context, slug string) (models.Artist, bool, error) {
+	return lookupArtist(ctx, func(c *ArtistCache) (int, bool) {
+		i, found := c.bySlug[slug]
+		return i, found
+	})
+}
+
+// lookupArtist finds an artist with one of the cache indexes, refreshing the
+// cache when it has expired
+func lookupArtist(ctx context.Context, index func(c *ArtistCache) (int, bool)) (models.Artist, bool, error) {
+	refreshAliases()
+
+	artistCache.mutex.RLock()
+	fresh := !artistCache.lastUpdate.IsZero() && time.Since(artistCache.lastUpdate) < cacheTTL
+	artistCache.mutex.RUnlock()
+	if fresh {
+		artistCache.stats.hit()
+	} else {
+		artistCache.stats.miss()
+		if _, err := loadArtists(ctx); err != nil {
+			return models.Artist{}, false, err
+		}
+	}
+
+	artistCache.mutex.RLock()
+	i, found := index(artistCache)
+	if !found {
+		artistCache.mutex.RUnlock()
+		return models.Artist{}, false, nil
+	}
+	artist := artistCache.artists[i]
+	artistCache.mutex.RUnlock()
+	return artist, true, nil
+}
+
+// loadArtists fetches the artists from the API and updates the cache
+func loadArtists(ctx context.Context) ([]models.Artist, error) {
+	artists, err := fetchArtistsFromAPI(ctx)
 	if err != nil {
+		if ctx.Err() == nil { // a cancelled caller says nothing about upstream
+			artistCache.stats.failed(err)
+		}
 		return nil, err
 	}
+	storeArtists(artists)
+	return artists, nil
+}
 
-	// Update cache
+// storeArtists assigns the slugs and aliases of the artists and swaps them
+// into the cache
+func storeArtists(artists []models.Artist) {
+	models.AssignSlugs(artists)
+	resolveArtistAliases(artists)
 	artistCache.mutex.Lock()
-	artistCache.artists = make([]models.Artist, len(artists))
-	copy(artistCache.artists, artists)
-	artistCache.lastUpdate = time.Now()
+	artistCache.set(artists, time.Now())
 	artistCache.mutex.Unlock()
+	cacheRefreshes.Inc("artists")
 
-	return artists, nil
+	notifyRefresh()
 }
 
-// fetchArtistsFromAPI gets all artists from the API without caching
-func fetchArtistsFromAPI() ([]models.Artist, error) {
-	resp, err := http.Get(baseURL + "/artists")
-	if err != nil {
-		return nil, err
+// set replaces the artists, whose slugs are assigned, and rebuilds the
+// indexes. The caller holds the write lock.
+func (c *ArtistCache) set(artists []models.Artist, updated time.Time) {
+	c.byID = make(map[int]int, len(artists))
+	c.bySlug = make(map[string]int, len(artists))
+	for i, artist := range artists {
+		c.byID[artist.ID] = i
+		c.bySlug[artist.Slug] = i
 	}
-	defer resp.Body.Close()
+	c.artists = make([]models.Artist, len(artists))
+	copy(c.artists, artists)
+	c.lastUpdate = updated
+}
 
+// fetchArtistsFromAPI gets all artists from the API without caching
+func fetchArtistsFromAPI(ctx context.Context) ([]models.Artist, error) {
 	var artists []models.Artist
-	err = json.NewDecoder(resp.Body).Decode(&artists)
+	err := getJSON(ctx, baseURL+"/artists", &artists)
 	return artists, err
 }
 
 // FetchAllLocations gets all locations data and builds a fast search index
-func FetchAllLocations() (map[string][]int, error) {
-	// Check cache first
+func FetchAllLocations(ctx context.Context) (map[string][]int, error) {
+	if err := refreshLocations(ctx); err != nil {
+		return nil, err
+	}
+
+	// Return a copy of the cached data
 	locationCache.mutex.RLock()
-	if !locationCache.lastUpdate.IsZero() && time.Since(locationCache.lastUpdate) < cacheTTL {
-		// Return a copy of the cached data
-		result := make(map[string][]int)
-		for k, v := range locationCache.locations {
-			result[k] = make([]int, len(v))
-			copy(result[k], v)
-		}
-		locationCache.mutex.RUnlock()
-		return result, nil
+	defer locationCache.mutex.RUnlock()
+	result := make(map[string][]int)
+	for k, v := range locationCache.locations {
+		result[k] = make([]int, len(v))
+		copy(result[k], v)
+	}
+	return result, nil
+}
+
+// FetchRelations gets the relation data of all artists with caching.
+// The returned relations are shared with the cache and must not be modified.
+func FetchRelations(ctx context.Context) ([]models.Relation, error) {
+	if err := refreshLocations(ctx); err != nil {
+		return nil, err
+	}
+
+	locationCache.mutex.RLock()
+	defer locationCache.mutex.RUnlock()
+	relations := make([]models.Relation, len(locationCache.relations))
+	copy(relations, locationCache.relations)
+	return relations, nil
+}
+
+// ConcertsNear returns the concerts within radiusKm of center, nearest first
+func ConcertsNear(ctx context.Context, center models.Coordinates, radiusKm float64) ([]geo.Result, error) {
+	if err := refreshLocations(ctx); err != nil {
+		return nil, err
+	}
+
+	locationCache.mutex.RLock()
+	spatial := locationCache.spatial
+	locationCache.mutex.RUnlock()
+	if spatial == nil {
+		// Cleared between the refresh and the query
+		return nil, nil
 	}
+	return spatial.Near(center, radiusKm), nil
+}
+
+// refreshLocations refetches the relation data when the location cache has expired
+func refreshLocations(ctx context.Context) error {
+	// Check cache first
+	locationCache.mutex.RLock()
+	fresh := !locationCache.lastUpdate.IsZero() && time.Since(locationCache.lastUpdate) < cacheTTL
 	locationCache.mutex.RUnlock()
+	if fresh {
+		locationCache.stats.hit()
+		return nil
+	}
+	locationCache.stats.miss()
+	return loadLocations(ctx)
+}
 
-	// Fetch fresh data
-	locations, err := fetchAllLocationsFromAPI()
+// loadLocations fetches the relation data from the API and rebuilds the
+// location indexes
+func loadLocations(ctx context.Context) error {
+	relations, err := fetchRelationsFromAPI(ctx)
 	if err != nil {
-		return nil, err
+		if ctx.Err() == nil {
+			locationCache.stats.failed(err)
+		}
+		return err
 	}
+	storeRelations(relations)
+	return nil
+}
 
-	// Update cache
+// storeRelations swaps the relations into the cache
+func storeRelations(relations []models.Relation) {
 	locationCache.mutex.Lock()
-	locationCache.locations = locations
-	locationCache.lastUpdate = time.Now()
+	locationCache.set(relations, time.Now())
 	locationCache.mutex.Unlock()
+	cacheRefreshes.Inc("locations")
 
-	return locations, nil
+	notifyRefresh()
 }
 
-// fetchAllLocationsFromAPI fetches all locations data from the API
-func fetchAllLocationsFromAPI() (map[string][]int, error) {
-	// Fetch all relations data
-	resp, err := http.Get(baseURL + "/relation")
-	if err != nil {
-		return nil, err
+// set replaces the relations and rebuilds the location indexes. The caller
+// holds the write lock.
+func (c *LocationCache) set(relations []models.Relation, updated time.Time) {
+	c.locations = buildLocationIndex(relations)
+	c.aliases = buildAliasIndex(c.locations)
+	c.spatial = buildSpatialIndex(relations)
+	c.relations = relations
+	c.lastUpdate = updated
+}
+
+// Refresh fetches the artists and relations from the API whether or not
+// the cache has expired
+func Refresh(ctx context.Context) error {
+	if _, err := loadArtists(ctx); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
+	return loadLocations(ctx)
+}
+
+// StartRefresher loads the caches and then refreshes them in the background
+// every interval, so the data is there before the first request and
+// upstream changes reach the OnRefresh listeners without waiting for one.
+// The returned function stops it, cancelling a refresh in progress and
+// waiting for it to return.
+func StartRefresher(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		next := time.Now().Add(interval)
+		for {
+			if err := Refresh(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("Background refresh failed", "err", err)
+			}
+			setNextRefresh(next)
+			select {
+			case <-ctx.Done():
+				setNextRefresh(time.Time{})
+				return
+			case tick := <-ticker.C:
+				next = tick.Add(interval)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			wg.Wait()
+		})
+	}
+}
 
+// fetchRelationsFromAPI fetches all relations data from the API
+func fetchRelationsFromAPI(ctx context.Context) ([]models.Relation, error) {
 	var relationIndex models.RelationIndex
-	err = json.NewDecoder(resp.Body).Decode(&relationIndex)
-	if err != nil {
+	if err := getJSON(ctx, baseURL+"/relation", &relationIndex); err != nil {
 		return nil, err
 	}
+	return relationIndex.Index, nil
+}
 
-	// Build location index
+// buildLocationIndex maps each cleaned location name to the artists playing there
+func buildLocationIndex(relations []models.Relation) map[string][]int {
 	locationIndex := make(map[string][]int)
 
-	for _, relation := range relationIndex.Index {
+	for _, relation := range relations {
 		artistID := relation.ID
 		for location := range relation.DatesLocations {
 			cleanedLocation := models.CleanLocationName(location)
@@ -131,22 +450,58 @@ func fetchAllLocationsFromAPI() (map[string][]int, error) {
 		}
 	}
 
-	return locationIndex, nil
+	return locationIndex
+}
+
+// buildSpatialIndex puts every concert with known coordinates on a 1° grid
+func buildSpatialIndex(relations []models.Relation) *geo.Index {
+	var concerts []models.Concert
+	for _, relation := range relations {
+		concerts = append(concerts, relation.Concerts()...)
+	}
+	geo.Locate(concerts)
+	return geo.NewIndex(concerts, 1)
+}
+
+// FetchLocationIndex returns every indexed location with its artists and coordinates
+func FetchLocationIndex(ctx context.Context) ([]models.LocationEntry, error) {
+	locations, err := FetchAllLocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]models.LocationEntry, 0, len(locations))
+	for name, artistIDs := range locations {
+		entry := models.LocationEntry{Name: name, ArtistIDs: artistIDs}
+		if coords, ok := geo.Lookup(name); ok {
+			entry.Coordinates = &coords
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
 }
 
 // SearchLocations performs fast location search using the cached index
-func SearchLocations(query string) ([]int, error) {
-	locations, err := FetchAllLocations()
+func SearchLocations(ctx context.Context, query string) ([]int, error) {
+	refreshAliases()
+
+	locations, err := FetchAllLocations(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	queryLower := strings.ToLower(query)
+	// A query that is an alias also finds the locations it names
+	searchQuery := strings.ToLower(query)
+	aliased := aliasedLocations(query)
 	var matchingArtistIDs []int
 	seen := make(map[int]bool)
 
 	for location, artistIDs := range locations {
-		if strings.Contains(strings.ToLower(location), queryLower) {
+		if aliased[location] || strings.Contains(strings.ToLower(location), searchQuery) {
 			for _, artistID := range artistIDs {
 				if !seen[artistID] {
 					matchingArtistIDs = append(matchingArtistIDs, artistID)
@@ -159,19 +514,111 @@ func SearchLocations(query string) ([]int, error) {
 	return matchingArtistIDs, nil
 }
 
-// ClearCache clears the artist cache
+// SearchArtists returns the artists matching a search query in their name,
+// aliases, members, first album or creation date. If none match, concert
+// locations are searched as well.
+func SearchArtists(ctx context.Context, query string) ([]models.Artist, error) {
+	artists, err := FetchArtists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only populate location data for search results, not all artists
+	// This is much faster than populating for all artists
+	searchQuery := strings.ToLower(query)
+	var results []models.Artist
+
+	// First pass: search without location data
+	for _, artist := range artists {
+		if strings.Contains(strings.ToLower(artist.Name), searchQuery) ||
+			containsAny(artist.Aliases, searchQuery) ||
+			strings.Contains(strings.ToLower(artist.FirstAlbum), searchQuery) ||
+			strings.Contains(strconv.Itoa(artist.CreationDate), searchQuery) ||
+			containsAny(artist.Members, searchQuery) {
+			results = append(results, artist)
+		}
+	}
+
+	// If no results found, try with location data (slower but more comprehensive)
+	if len(results) == 0 {
+		// Populate location data only for search
+		artistsWithLocations := populateLocationData(ctx, artists)
+		for _, artist := range artistsWithLocations {
+			if strings.Contains(artist.GetSearchableText(), searchQuery) {
+				results = append(results, artist)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// containsAny checks if any member contains the search query
+func containsAny(members []string, query string) bool {
+	for _, member := range members {
+		if strings.Contains(strings.ToLower(member), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// populateLocationData fetches and populates location data for all artists
+func populateLocationData(ctx context.Context, artists []models.Artist) []models.Artist {
+	for i := range artists {
+		relation, err := FetchRelation(ctx, artists[i].Relations)
+		if err != nil {
+			slog.WarnContext(ctx, "Fetching relation failed", "artist", artists[i].ID, "err", err)
+			continue
+		}
+
+		// Extract location names from relation data
+		var locations []string
+		for location := range relation.DatesLocations {
+			locations = append(locations, models.CleanLocationName(location))
+		}
+		artists[i].LocationList = locations
+	}
+	return artists
+}
+
+// ClearCache clears the artist and location caches
 func ClearCache() {
+	clearArtists()
+	clearLocations()
+}
+
+func clearArtists() {
 	artistCache.mutex.Lock()
 	artistCache.artists = nil
+	artistCache.byID = nil
+	artistCache.bySlug = nil
 	artistCache.lastUpdate = time.Time{}
 	artistCache.mutex.Unlock()
+}
 
+func clearLocations() {
 	locationCache.mutex.Lock()
 	locationCache.locations = make(map[string][]int)
+	locationCache.relations = nil
+	locationCache.spatial = nil
 	locationCache.lastUpdate = time.Time{}
 	locationCache.mutex.Unlock()
 }
 
+// DatasetUpdated returns when the artists and the relations were last
+// fetched, zero if they are not loaded
+func DatasetUpdated() (artists, relations time.Time) {
+	artistCache.mutex.RLock()
+	artists = artistCache.lastUpdate
+	artistCache.mutex.RUnlock()
+
+	locationCache.mutex.RLock()
+	relations = locationCache.lastUpdate
+	locationCache.mutex.RUnlock()
+	return artists, relations
+}
+
 // GetCacheStatus returns cache information
 func GetCacheStatus() (bool, time.Time) {
 	artistCache.mutex.RLock()
@@ -180,51 +627,48 @@ func GetCacheStatus() (bool, time.Time) {
 }
 
 // FetchLocation gets location data for an artist
-func FetchLocation(url string) (models.Location, error) {
+func FetchLocation(ctx context.Context, url string) (models.Location, error) {
 	var location models.Location
-	resp, err := http.Get(url)
-	if err != nil {
-		return location, err
-	}
-	defer resp.Body.Close()
-
-	err = json.NewDecoder(resp.Body).Decode(&location)
+	err := getJSON(ctx, url, &location)
 	return location, err
 }
 
 // FetchRelation gets relation data for an artist
-func FetchRelation(url string) (models.Relation, error) {
+func FetchRelation(ctx context.Context, url string) (models.Relation, error) {
 	var relation models.Relation
-	resp, err := http.Get(url)
-	if err != nil {
-		return relation, err
-	}
-	defer resp.Body.Close()
-
-	err = json.NewDecoder(resp.Body).Decode(&relation)
+	err := getJSON(ctx, url, &relation)
 	return relation, err
 }
 
 // GetLocationSuggestions returns location names that match the query
-func GetLocationSuggestions(query string, limit int) ([]string, error) {
-	locations, err := FetchAllLocations()
+func GetLocationSuggestions(ctx context.Context, query string, limit int) ([]string, error) {
+	refreshAliases()
+
+	locations, err := FetchAllLocations(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	queryLower := strings.ToLower(query)
 	var suggestions []string
 	seen := make(map[string]bool)
+	add := func(location string) bool {
+		if !seen[location] {
+			suggestions = append(suggestions, location)
+			seen[location] = true
+		}
+		return len(suggestions) >= limit
+	}
 
+	// Locations reached through an alias come first
+	for _, location := range aliasSuggestions(query) {
+		if add(location) {
+			return suggestions, nil
+		}
+	}
+	searchQuery := strings.ToLower(query)
 	for location := range locations {
-		if strings.Contains(strings.ToLower(location), queryLower) {
-			if !seen[location] {
-				suggestions = append(suggestions, location)
-				seen[location] = true
-				if len(suggestions) >= limit {
-					break
-				}
-			}
+		if strings.Contains(strings.ToLower(location), searchQuery) && add(location) {
+			return suggestions, nil
 		}
 	}
 
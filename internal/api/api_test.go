@@ -1,3 +1,562 @@
 package api
 
 //testclear
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/metrics"
+	"groupie-tracker/internal/models"
+)
+
+// startUpstream serves a small fake copy of the upstream API
+func startUpstream(t *testing.T) {
+	t.Helper()
+
+	artists := []models.Artist{
+		{ID: 1, Name: "Queen", Members: []string{"Freddie Mercury"}},
+		{ID: 2, Name: "AC/DC", Members: []string{"Angus Young"}},
+	}
+	relations := models.RelationIndex{Index: []models.Relation{
+		{ID: 1, DatesLocations: map[string][]string{"london-uk": {"14-06-1986"}, "la_plata-argentina": {"20-02-1981"}}},
+		{ID: 2, DatesLocations: map[string][]string{"new_york-usa": {"03-08-1988"}, "los_angeles-usa": {"05-08-1988"}}},
+	}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artists", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(artists)
+	})
+	mux.HandleFunc("/relation", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(relations)
+	})
+	server := httptest.NewServer(mux)
+
+	previous := baseURL
+	baseURL = server.URL
+	ClearCache()
+	t.Cleanup(func() {
+		server.Close()
+		baseURL = previous
+		ClearCache()
+	})
+}
+
+// useAliases points the alias store at a temporary file with the given aliases
+func useAliases(t *testing.T, aliases Aliases) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	writeAliases(t, path, aliases)
+	if err := SetAliasFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetAliasFile(defaultAliasFile()) })
+	return path
+}
+
+func writeAliases(t *testing.T, path string, aliases Aliases) {
+	t.Helper()
+
+	data, err := json.Marshal(aliases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocationAliases(t *testing.T) {
+	startUpstream(t)
+	useAliases(t, Aliases{Locations: map[string]string{"NYC": "new_york-usa", "England": "Uk"}})
+
+	ids, err := SearchLocations(context.Background(), "nyc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("SearchLocations(nyc) = %v, want [2]", ids)
+	}
+
+	ids, err = SearchLocations(context.Background(), "England")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("SearchLocations(England) = %v, want [1]", ids)
+	}
+
+	suggestions, err := GetLocationSuggestions(context.Background(), "NY", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) == 0 || suggestions[0] != "New York Usa" {
+		t.Errorf("GetLocationSuggestions(NY) = %v, want New York Usa first", suggestions)
+	}
+
+	// Aliases changed after loading apply at once, and an alias still
+	// matches the locations containing it
+	useAliases(t, Aliases{Locations: map[string]string{"LA": "los_angeles-usa"}})
+	ids, err = SearchLocations(context.Background(), "LA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(ids)
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("SearchLocations(LA) = %v, want La Plata's [1] and Los Angeles' [2]", ids)
+	}
+}
+
+func TestAliasIndexMatchesWholeWords(t *testing.T) {
+	useAliases(t, Aliases{Locations: map[string]string{"England": "Uk", "America": "Usa", "Uk": "Uk"}})
+
+	locations := map[string][]int{"London Uk": {1}, "Milwaukee Usa": {2}, "Busan South Korea": {3}, "Kiev Ukraine": {4}}
+	index := buildAliasIndex(locations)
+	for alias, want := range map[string]string{"england": "London Uk", "america": "Milwaukee Usa", "uk": "London Uk"} {
+		if got := index[alias]; len(got) != 1 || got[0] != want {
+			t.Errorf("alias %q names %v, want [%s]", alias, got, want)
+		}
+	}
+}
+
+func TestArtistAliasesReload(t *testing.T) {
+	startUpstream(t)
+	path := useAliases(t, Aliases{Artists: map[string]string{"ACDC": "AC/DC"}})
+
+	artists, err := FetchArtists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := artists[1].Aliases; len(got) != 1 || got[0] != "ACDC" {
+		t.Errorf("AC/DC aliases = %v, want [ACDC]", got)
+	}
+
+	// Changing the file is picked up without clearing the artist cache
+	writeAliases(t, path, Aliases{Artists: map[string]string{"ACDC": "AC/DC", "AC DC": "AC/DC"}})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	aliasCheckInterval = 0
+	t.Cleanup(func() { aliasCheckInterval = 2 * time.Second })
+
+	artists, err = FetchArtists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := artists[1].Aliases; len(got) != 2 {
+		t.Errorf("AC/DC aliases after reload = %v, want 2 aliases", got)
+	}
+}
+
+func TestRefresherStops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"index": []}`))
+	}))
+	defer server.Close()
+
+	// Count the requests as the refresher sends them: one cancelled by stop
+	// may still reach the server afterwards
+	var mutex sync.Mutex
+	requests := 0
+	counted := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+	transport := client.Transport
+	client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		requests++
+		mutex.Unlock()
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	previous := baseURL
+	baseURL = server.URL
+	defer func() { baseURL = previous; client.Transport = transport; ClearCache() }()
+
+	stop := StartRefresher(10 * time.Millisecond)
+	for deadline := time.Now().Add(2 * time.Second); counted() < 4 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	stop() // stopping twice is harmless
+
+	after := counted()
+	if after < 4 {
+		t.Fatalf("refresher made %d requests, want at least 4", after)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := counted(); got != after {
+		t.Errorf("refresher made %d requests after stopping", got-after)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRefresherStopCancelsRefresh(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done() // hang until the refresh is cancelled
+	}))
+	defer server.Close()
+
+	previous := baseURL
+	baseURL = server.URL
+	defer func() { baseURL = previous; ClearCache() }()
+
+	before := CacheStatuses()[0].LastErrorAt
+	stop := StartRefresher(time.Hour)
+	<-started
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stop waited for the hanging refresh")
+	}
+	if status := CacheStatuses()[0]; !reflect.DeepEqual(status.LastErrorAt, before) {
+		t.Errorf("cancelled refresh recorded error %q", status.LastError)
+	}
+}
+
+func TestArtistLookup(t *testing.T) {
+	startUpstream(t)
+
+	artist, found, err := ArtistByID(context.Background(), 2)
+	if err != nil || !found || artist.Name != "AC/DC" {
+		t.Errorf("ArtistByID(2) = %v, %v, %v, want AC/DC", artist.Name, found, err)
+	}
+	artist, found, err = ArtistBySlug(context.Background(), "ac-dc")
+	if err != nil || !found || artist.ID != 2 {
+		t.Errorf("ArtistBySlug(ac-dc) = %v, %v, %v, want AC/DC", artist.ID, found, err)
+	}
+	if _, found, _ := ArtistByID(context.Background(), 3); found {
+		t.Error("ArtistByID(3) found an artist")
+	}
+}
+
+// metricValue returns the current value of a series in the default registry
+func metricValue(t *testing.T, series string) float64 {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := metrics.Default.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if value, found := strings.CutPrefix(line, series+" "); found {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestCacheMetrics(t *testing.T) {
+	startUpstream(t)
+	ctx := context.Background()
+	hits, misses := `groupie_cache_hits_total{cache="artists"}`, `groupie_cache_misses_total{cache="artists"}`
+	requests := `groupie_upstream_requests_total{endpoint="/artists",status="200"}`
+	before := map[string]float64{hits: metricValue(t, hits), misses: metricValue(t, misses), requests: metricValue(t, requests)}
+
+	for i := 0; i < 3; i++ {
+		if _, err := FetchArtists(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for series, want := range map[string]float64{hits: 2, misses: 1, requests: 1} {
+		if got := metricValue(t, series) - before[series]; got != want {
+			t.Errorf("%s went up by %v, want %v", series, got, want)
+		}
+	}
+	if got := metricValue(t, "groupie_artists"); got != 2 {
+		t.Errorf("groupie_artists = %v, want 2", got)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	startUpstream(t)
+	for url, want := range map[string]string{
+		baseURL + "/artists":              "/artists",
+		baseURL + "/relation/12":          "/relation/{id}",
+		baseURL + "/locations/3?x=1":      "/locations/{id}",
+		"https://example.com/api/dates/7": "/api/dates/{id}",
+	} {
+		if got := endpoint(url); got != want {
+			t.Errorf("endpoint(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := &breaker{}
+	start := time.Now()
+
+	for i := 0; i < breakerThreshold-1; i++ {
+		b.allow(start)
+		b.record(true, start)
+	}
+	if got := b.status(start).State; got != BreakerClosed {
+		t.Fatalf("after %d failures the breaker is %s, want closed", breakerThreshold-1, got)
+	}
+	b.allow(start)
+	b.record(true, start)
+	if b.allow(start) || b.status(start).State != BreakerOpen {
+		t.Fatal("the breaker let a call through after reaching the threshold")
+	}
+
+	// After the cooldown one probe goes through at a time
+	later := start.Add(breakerCooldown)
+	if got := b.status(later).State; got != BreakerHalfOpen {
+		t.Errorf("after the cooldown the breaker is %s, want half-open", got)
+	}
+	if !b.allow(later) || b.allow(later) {
+		t.Fatal("want exactly one probe after the cooldown")
+	}
+	b.record(true, later)
+	if b.allow(later.Add(time.Second)) {
+		t.Error("a failed probe did not restart the cooldown")
+	}
+
+	// A cancelled probe frees the slot, a successful one closes the breaker
+	evenLater := later.Add(breakerCooldown)
+	b.allow(evenLater)
+	b.release()
+	if !b.allow(evenLater) {
+		t.Fatal("a released probe kept the slot")
+	}
+	b.record(false, evenLater)
+	if status := b.status(evenLater); status.State != BreakerClosed || status.Failures != 0 {
+		t.Errorf("after a successful probe the breaker is %+v, want closed", status)
+	}
+}
+
+func TestBreakerFailsFast(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+	defer SetBaseURL(baseURL)
+	SetBaseURL(server.URL)
+
+	for i := 0; i < breakerThreshold+3; i++ {
+		FetchArtists(context.Background())
+	}
+	if requests != breakerThreshold {
+		t.Errorf("upstream got %d requests, want %d before the breaker opened", requests, breakerThreshold)
+	}
+	if _, err := FetchArtists(context.Background()); err != ErrUpstreamUnavailable {
+		t.Errorf("err = %v, want ErrUpstreamUnavailable", err)
+	}
+}
+
+func TestUpstreamStatusErrors(t *testing.T) {
+	defer SetBaseURL(baseURL)
+	for _, code := range []int{http.StatusServiceUnavailable, http.StatusNotFound} {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(code)
+			w.Write([]byte(`[]`)) // decodes fine, but must not be taken as the artists
+		}))
+		SetBaseURL(server.URL)
+		errorsSeries := fmt.Sprintf(`groupie_upstream_errors_total{endpoint="/artists",status="%d"}`, code)
+		before := metricValue(t, errorsSeries)
+
+		_, err := FetchArtists(context.Background())
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != code {
+			t.Errorf("%d: err = %v, want a StatusError", code, err)
+		}
+		if got := metricValue(t, errorsSeries) - before; got != 1 {
+			t.Errorf("%s went up by %v, want 1", errorsSeries, got)
+		}
+
+		for i := 1; i < breakerThreshold+3; i++ {
+			FetchArtists(context.Background())
+		}
+		if requests != breakerThreshold {
+			t.Errorf("%d: upstream got %d requests, want %d before the breaker opened", code, requests, breakerThreshold)
+		}
+		server.Close()
+	}
+}
+
+func TestCacheStatuses(t *testing.T) {
+	startUpstream(t)
+	ctx := context.Background()
+	cacheStatus := func(name string) CacheStatus {
+		for _, status := range CacheStatuses() {
+			if status.Name == name {
+				return status
+			}
+		}
+		t.Fatalf("no status for the %s cache", name)
+		return CacheStatus{}
+	}
+	before := cacheStatus(ArtistsCache)
+
+	for i := 0; i < 3; i++ {
+		if _, err := FetchArtists(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	artists := cacheStatus(ArtistsCache)
+	if !artists.Loaded || artists.Entries != 2 || artists.SizeBytes == 0 || artists.ExpiresAt == nil {
+		t.Errorf("artists cache = %+v, want 2 loaded entries", artists)
+	}
+	if hits, misses := artists.Hits-before.Hits, artists.Misses-before.Misses; hits != 2 || misses != 1 {
+		t.Errorf("artists cache counted %d hits and %d misses, want 2 and 1", hits, misses)
+	}
+	if locations := cacheStatus(LocationsCache); locations.Loaded || locations.LastUpdate != nil {
+		t.Errorf("locations cache = %+v, want it not loaded", locations)
+	}
+
+	if err := Invalidate(ArtistsCache); err != nil {
+		t.Fatal(err)
+	}
+	if artists := cacheStatus(ArtistsCache); artists.Loaded || artists.Entries != 0 {
+		t.Errorf("after Invalidate the artists cache is %+v", artists)
+	}
+	if err := Invalidate("dates"); !errors.Is(err, ErrUnknownCache) {
+		t.Errorf("Invalidate(dates) = %v, want ErrUnknownCache", err)
+	}
+
+	// A failed load is kept as the last error
+	baseURL += "/down"
+	defer upstreamBreaker.reset()
+	if _, err := FetchArtists(ctx); err == nil {
+		t.Fatal("fetching from a missing endpoint succeeded")
+	}
+	if artists := cacheStatus(ArtistsCache); artists.LastError == "" || artists.LastErrorAt == nil {
+		t.Errorf("artists cache = %+v, want the last error", artists)
+	}
+}
+
+func TestRefreshArtist(t *testing.T) {
+	var mu sync.Mutex
+	names := map[int]string{1: "Queen", 2: "AC/DC"}
+	locations := map[int]string{1: "london-uk", 2: "new_york-usa"}
+	var server *httptest.Server
+	var duringFetch func() // runs while an artist is being fetched
+	artist := func(id int) models.Artist {
+		return models.Artist{ID: id, Name: names[id], Relations: server.URL + "/relation/" + strconv.Itoa(id)}
+	}
+	relation := func(id int) models.Relation {
+		return models.Relation{ID: id, DatesLocations: map[string][]string{locations[id]: {"14-06-1986"}}}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artists", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode([]models.Artist{artist(1), artist(2)})
+	})
+	mux.HandleFunc("/artists/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if duringFetch != nil {
+			duringFetch()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		if _, known := names[id]; !known {
+			json.NewEncoder(w).Encode(models.Artist{}) // like the upstream API
+			return
+		}
+		json.NewEncoder(w).Encode(artist(id))
+	})
+	mux.HandleFunc("/relation", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(models.RelationIndex{Index: []models.Relation{relation(1), relation(2)}})
+	})
+	mux.HandleFunc("/relation/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		json.NewEncoder(w).Encode(relation(id))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+	previous := baseURL
+	baseURL = server.URL
+	defer func() {
+		baseURL = previous
+		ClearCache()
+	}()
+
+	ctx := context.Background()
+	if err := Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	artistsUpdated, relationsUpdated := DatasetUpdated()
+
+	mu.Lock()
+	names[1], locations[1] = "Queen + Adam Lambert", "paris-france"
+	names[2] = "AC/DC (changed)"
+	mu.Unlock()
+
+	if found, err := RefreshArtist(ctx, 1); err != nil || !found {
+		t.Fatalf("RefreshArtist(1) = %v, %v", found, err)
+	}
+	if artist, _, _ := ArtistByID(ctx, 1); artist.Name != "Queen + Adam Lambert" {
+		t.Errorf("artist 1 is %q after the refresh", artist.Name)
+	}
+	if artist, _, _ := ArtistByID(ctx, 2); artist.Name != "AC/DC" {
+		t.Errorf("artist 2 is %q, want it left as it was", artist.Name)
+	}
+	if ids, err := SearchLocations(ctx, "paris"); err != nil || len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("SearchLocations(paris) = %v, %v, want the new relation of artist 1", ids, err)
+	}
+	if a, r := DatasetUpdated(); !a.Equal(artistsUpdated) || !r.Equal(relationsUpdated) {
+		t.Error("refreshing one artist moved the expiry of the whole cache")
+	}
+
+	if found, err := RefreshArtist(ctx, 9); err != nil || found {
+		t.Errorf("RefreshArtist(9) = %v, %v, want not found", found, err)
+	}
+
+	// A full refresh finishing while one artist is fetched is kept
+	duringFetch = func() {
+		if err := Refresh(ctx); err != nil {
+			t.Error(err)
+		}
+	}
+	if found, err := RefreshArtist(ctx, 1); err != nil || !found {
+		t.Fatalf("RefreshArtist(1) = %v, %v", found, err)
+	}
+	if artist, _, _ := ArtistByID(ctx, 2); artist.Name != "AC/DC (changed)" {
+		t.Errorf("artist 2 is %q, want the full refresh kept", artist.Name)
+	}
+}
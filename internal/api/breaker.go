@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// The breaker opens after breakerThreshold upstream failures in a row.
+// While it is open, upstream calls fail at once instead of waiting for the
+// client timeout; after breakerCooldown one call is let through to see
+// whether the upstream API is back.
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// ErrUpstreamUnavailable is returned instead of calling the upstream API
+// while the breaker is open
+var ErrUpstreamUnavailable = errors.New("upstream API unavailable after repeated failures, not retrying yet")
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"    // calls go through
+	BreakerOpen     = "open"      // calls fail at once
+	BreakerHalfOpen = "half-open" // the next call tries the upstream API again
+)
+
+// BreakerStatus describes the upstream breaker
+type BreakerStatus struct {
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`           // failures in a row
+	OpenedAt time.Time `json:"openedAt,omitempty"` // last time it opened
+}
+
+type breaker struct {
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	probing  bool      // a call is trying the upstream API after the cooldown
+}
+
+var upstreamBreaker = &breaker{}
+
+// allow reports whether a call may go to the upstream API. Every allowed
+// call must be followed by record or release.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || now.Sub(b.openedAt) < breakerCooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of an upstream call
+func (b *breaker) record(failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openedAt = now // a failed probe starts a new cooldown
+	}
+}
+
+// release ends a call whose outcome says nothing about the upstream API,
+// like one cancelled by the client
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *breaker) reset() {
+	b.mu.Lock()
+	b.failures, b.openedAt, b.probing = 0, time.Time{}, false
+	b.mu.Unlock()
+}
+
+func (b *breaker) status(now time.Time) BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{State: BreakerClosed, Failures: b.failures, OpenedAt: b.openedAt}
+	if !b.openedAt.IsZero() {
+		status.State = BreakerOpen
+		if now.Sub(b.openedAt) >= breakerCooldown {
+			status.State = BreakerHalfOpen
+		}
+	}
+	return status
+}
+
+// UpstreamBreaker returns the state of the upstream breaker
+func UpstreamBreaker() BreakerStatus {
+	return upstreamBreaker.status(time.Now())
+}
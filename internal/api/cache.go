@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// Cache names, as used by Invalidate and in CacheStatus
+const (
+	ArtistsCache   = "artists"
+	LocationsCache = "locations"
+)
+
+// ErrUnknownCache is returned by Invalidate for a name that is not a cache
+var ErrUnknownCache = errors.New("unknown cache")
+
+// cacheStats counts the lookups of a cache and remembers its last failed
+// load. The hit and miss counts are the ones of groupie_cache_hits_total
+// and groupie_cache_misses_total, kept here too for the admin status.
+type cacheStats struct {
+	name   string
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	mu        sync.Mutex
+	lastErr   string
+	lastErrAt time.Time
+}
+
+func (s *cacheStats) hit() {
+	s.hits.Add(1)
+	cacheHits.Inc(s.name)
+}
+
+func (s *cacheStats) miss() {
+	s.misses.Add(1)
+	cacheMisses.Inc(s.name)
+}
+
+// failed records an error loading the cache from upstream
+func (s *cacheStats) failed(err error) {
+	s.mu.Lock()
+	s.lastErr, s.lastErrAt = err.Error(), time.Now()
+	s.mu.Unlock()
+}
+
+// fill copies the counts and the last error into a status
+func (s *cacheStats) fill(status *CacheStatus) {
+	status.Hits, status.Misses = s.hits.Load(), s.misses.Load()
+	s.mu.Lock()
+	status.LastError = s.lastErr
+	if !s.lastErrAt.IsZero() {
+		status.LastErrorAt = timePtr(s.lastErrAt)
+	}
+	s.mu.Unlock()
+}
+
+// nextRefresh is when the background refresher runs next, zero when it is
+// not running
+var (
+	nextRefresh   time.Time
+	nextRefreshMu sync.Mutex
+)
+
+func setNextRefresh(t time.Time) {
+	nextRefreshMu.Lock()
+	nextRefresh = t
+	nextRefreshMu.Unlock()
+}
+
+// CacheStatus describes one cache. Times are nil when they do not apply:
+// LastUpdate and ExpiresAt while the cache is empty, NextRefresh when the
+// background refresher is off and LastErrorAt until a load fails.
+type CacheStatus struct {
+	Name        string     `json:"name"`
+	Loaded      bool       `json:"loaded"`
+	Entries     int        `json:"entries"`
+	SizeBytes   int        `json:"sizeBytes"` // size of the entries encoded as JSON
+	LastUpdate  *time.Time `json:"lastUpdate"`
+	Age         string     `json:"age,omitempty"`
+	TTL         string     `json:"ttl"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	NextRefresh *time.Time `json:"nextRefresh"`
+	Hits        uint64     `json:"hits"`
+	Misses      uint64     `json:"misses"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt"`
+}
+
+// CacheStatuses describes the artist and location caches
+func CacheStatuses() []CacheStatus {
+	now := time.Now()
+	nextRefreshMu.Lock()
+	next := nextRefresh
+	nextRefreshMu.Unlock()
+
+	artistCache.mutex.RLock()
+	artists := newCacheStatus(ArtistsCache, len(artistCache.artists), jsonSize(artistCache.artists), artistCache.lastUpdate, now)
+	artistCache.mutex.RUnlock()
+	artistCache.stats.fill(&artists)
+
+	locationCache.mutex.RLock()
+	locations := newCacheStatus(LocationsCache, len(locationCache.locations),
+		jsonSize(locationCache.locations)+jsonSize(locationCache.relations), locationCache.lastUpdate, now)
+	locationCache.mutex.RUnlock()
+	locationCache.stats.fill(&locations)
+
+	statuses := []CacheStatus{artists, locations}
+	for i := range statuses {
+		if !next.IsZero() {
+			statuses[i].NextRefresh = timePtr(next)
+		}
+	}
+	return statuses
+}
+
+func newCacheStatus(name string, entries, size int, lastUpdate, now time.Time) CacheStatus {
+	status := CacheStatus{Name: name, Entries: entries, TTL: cacheTTL.String()}
+	if !lastUpdate.IsZero() {
+		status.Loaded = true
+		status.SizeBytes = size
+		status.LastUpdate = timePtr(lastUpdate)
+		status.Age = now.Sub(lastUpdate).Round(time.Second).String()
+		status.ExpiresAt = timePtr(lastUpdate.Add(cacheTTL))
+	}
+	return status
+}
+
+// jsonSize estimates the memory held by a cache from its JSON encoding
+func jsonSize(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// Invalidate empties one cache, so the next lookup fetches it from upstream
+func Invalidate(name string) error {
+	switch name {
+	case ArtistsCache:
+		clearArtists()
+	case LocationsCache:
+		clearLocations()
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownCache, name)
+	}
+	return nil
+}
+
+// RefreshArtist fetches one artist and its relation from upstream again and
+// replaces them in the caches, leaving the other entries as they are. It
+// reports false when upstream has no artist with the ID. An empty artist
+// cache is loaded in full instead.
+func RefreshArtist(ctx context.Context, id int) (bool, error) {
+	artistCache.mutex.RLock()
+	loaded := !artistCache.lastUpdate.IsZero()
+	artistCache.mutex.RUnlock()
+
+	if !loaded {
+		artists, err := loadArtists(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, artist := range artists {
+			if artist.ID == id {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var artist models.Artist
+	var statusErr *StatusError
+	err := getJSON(ctx, fmt.Sprintf("%s/artists/%d", baseURL, id), &artist)
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if artist.ID != id {
+		return false, nil // upstream answers unknown IDs with an empty artist
+	}
+	changed := replaceArtist(artist)
+
+	relationChanged, err := refreshRelation(ctx, artist)
+	if changed || relationChanged {
+		notifyRefresh()
+	}
+	return true, err
+}
+
+// replaceArtist puts one artist into the current cache and reports whether
+// that changed it. The swap happens under the write lock on whatever the
+// cache holds then, so a full refresh in the meantime is not undone; the
+// cache keeps its lastUpdate, so the other entries still expire on time.
+func replaceArtist(artist models.Artist) bool {
+	artistCache.mutex.Lock()
+	defer artistCache.mutex.Unlock()
+	if artistCache.lastUpdate.IsZero() {
+		return false // cleared meanwhile, the next lookup loads everything
+	}
+
+	artists := make([]models.Artist, len(artistCache.artists), len(artistCache.artists)+1)
+	copy(artists, artistCache.artists)
+	if i, cached := artistCache.byID[artist.ID]; cached {
+		artists[i] = artist
+	} else {
+		artists = append(artists, artist)
+		sort.Slice(artists, func(i, j int) bool { return artists[i].ID < artists[j].ID })
+	}
+	models.AssignSlugs(artists)
+	resolveArtistAliases(artists)
+	if reflect.DeepEqual(artists, artistCache.artists) {
+		return false
+	}
+	artistCache.set(artists, artistCache.lastUpdate)
+	return true
+}
+
+// refreshRelation fetches the relation of an artist and puts it into the
+// location cache, if it is loaded, and reports whether that changed it
+func refreshRelation(ctx context.Context, artist models.Artist) (bool, error) {
+	locationCache.mutex.RLock()
+	loaded := !locationCache.lastUpdate.IsZero()
+	locationCache.mutex.RUnlock()
+	if !loaded {
+		return false, nil
+	}
+
+	relation, err := FetchRelation(ctx, artist.Relations)
+	if err != nil {
+		return false, err
+	}
+	relation.ID = artist.ID
+
+	locationCache.mutex.Lock()
+	defer locationCache.mutex.Unlock()
+	if locationCache.lastUpdate.IsZero() {
+		return false, nil
+	}
+	relations := make([]models.Relation, 0, len(locationCache.relations)+1)
+	replaced := false
+	for _, current := range locationCache.relations {
+		if current.ID == relation.ID {
+			if reflect.DeepEqual(current, relation) {
+				return false, nil
+			}
+			current, replaced = relation, true
+		}
+		relations = append(relations, current)
+	}
+	if !replaced {
+		relations = append(relations, relation)
+	}
+	locationCache.set(relations, locationCache.lastUpdate)
+	return true, nil
+}
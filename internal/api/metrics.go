@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+
+	"groupie-tracker/internal/metrics"
+)
+
+// Metrics of the upstream calls and the caches. The cache label is
+// "artists" for the ArtistCache and "locations" for the LocationCache.
+var (
+	upstreamRequests = metrics.NewCounter("groupie_upstream_requests_total",
+		"Requests to the upstream API by endpoint and status code, 0 when there was no response.", "endpoint", "status")
+	upstreamErrors = metrics.NewCounter("groupie_upstream_errors_total",
+		"Upstream requests that failed, answered other than 2xx or returned an unreadable body, by endpoint and status code, 0 when there was no response.", "endpoint", "status")
+	upstreamDuration = metrics.NewHistogram("groupie_upstream_request_duration_seconds",
+		"Time taken by upstream requests by endpoint, including reading the body.", metrics.DefaultBuckets, "endpoint")
+
+	cacheHits = metrics.NewCounter("groupie_cache_hits_total",
+		"Lookups answered from a cache that had not expired.", "cache")
+	cacheMisses = metrics.NewCounter("groupie_cache_misses_total",
+		"Lookups that found a cache empty or expired and fetched from upstream.", "cache")
+	cacheRefreshes = metrics.NewCounter("groupie_cache_refreshes_total",
+		"Successful reloads of a cache from upstream, by requests or the background refresher.", "cache")
+)
+
+func init() {
+	metrics.NewGaugeFunc("groupie_artists", "Artists in the cache.", func() float64 {
+		artistCache.mutex.RLock()
+		defer artistCache.mutex.RUnlock()
+		return float64(len(artistCache.artists))
+	})
+	metrics.NewGaugeFunc("groupie_locations", "Distinct concert locations in the cache.", func() float64 {
+		locationCache.mutex.RLock()
+		defer locationCache.mutex.RUnlock()
+		return float64(len(locationCache.locations))
+	})
+	metrics.NewGaugeFunc("groupie_upstream_breaker_open", "1 while upstream calls fail at once after repeated failures, 0 otherwise.", func() float64 {
+		if UpstreamBreaker().State == BreakerOpen {
+			return 1
+		}
+		return 0
+	})
+	metrics.NewGaugeFunc("groupie_concerts", "Concert dates in the cache.", func() float64 {
+		locationCache.mutex.RLock()
+		defer locationCache.mutex.RUnlock()
+		concerts := 0
+		for _, relation := range locationCache.relations {
+			for _, dates := range relation.DatesLocations {
+				concerts += len(dates)
+			}
+		}
+		return float64(concerts)
+	})
+}
+
+// endpoint names the upstream endpoint of a URL for the metrics, with IDs
+// replaced so each endpoint is one series: /artists, /relation/{id}
+func endpoint(rawURL string) string {
+	path := strings.TrimPrefix(rawURL, baseURL)
+	if u, err := url.Parse(path); err == nil {
+		path = u.Path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
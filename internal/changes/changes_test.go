@@ -0,0 +1,207 @@
+package changes
+
+import (
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+func snapshot(artists []models.Artist, relations []models.Relation) models.Snapshot {
+	return models.Snapshot{Time: time.Now(), Artists: artists, Relations: relations}
+}
+
+func TestDiff(t *testing.T) {
+	queen := models.Artist{ID: 1, Name: "Queen"}
+	acdc := models.Artist{ID: 2, Name: "AC/DC"}
+	prev := snapshot([]models.Artist{queen}, []models.Relation{
+		{ID: 1, DatesLocations: map[string][]string{"london-uk": {"14-06-1986", "15-06-1986"}}},
+	})
+	next := snapshot([]models.Artist{queen, acdc}, []models.Relation{
+		{ID: 1, DatesLocations: map[string][]string{"london-uk": {"*14-06-1986"}, "paris-france": {"20-06-1986"}}},
+		{ID: 2, DatesLocations: map[string][]string{"sydney-australia": {"01-02-1990"}}},
+	})
+
+	change := Diff(prev, next)
+	if len(change.ArtistsAdded) != 1 || change.ArtistsAdded[0].Name != "AC/DC" {
+		t.Errorf("ArtistsAdded = %v", change.ArtistsAdded)
+	}
+	if len(change.DatesAdded) != 2 || change.DatesAdded[0].Location != "Paris France" || change.DatesAdded[1].ArtistName != "AC/DC" {
+		t.Errorf("DatesAdded = %v", change.DatesAdded)
+	}
+	if len(change.DatesRemoved) != 1 || change.DatesRemoved[0].Date != "15-06-1986" {
+		t.Errorf("DatesRemoved = %v", change.DatesRemoved)
+	}
+
+	if groups := change.DatesByLocation(); len(groups) != 3 || groups[1].Location != "London Uk" || len(groups[1].Removed) != 1 {
+		t.Errorf("DatesByLocation = %+v", groups)
+	}
+
+	// Relations missing on one side are not compared
+	if change := Diff(snapshot(prev.Artists, nil), next); len(change.DatesAdded) != 0 || len(change.ArtistsAdded) != 1 {
+		t.Errorf("partial diff = %+v", change)
+	}
+}
+
+func TestObserveBaselineAndPersistence(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	var seen []Change
+	tracker.subscribers = nil
+	Subscribe(func(c Change) { seen = append(seen, c) })
+
+	artists := []models.Artist{{ID: 1, Name: "Queen"}}
+	stop := Start()
+	Observe(snapshot(artists, nil))
+	stop()
+	if len(seen) != 0 {
+		t.Fatalf("first snapshot should only be the baseline, got %v", seen)
+	}
+
+	// A restart keeps the baseline
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	stop = Start()
+	Observe(snapshot(append(artists, models.Artist{ID: 2, Name: "AC/DC"}), nil))
+	stop()
+	if len(seen) != 1 || len(seen[0].ArtistsAdded) != 1 {
+		t.Fatalf("changes after restart = %v, want AC/DC added", seen)
+	}
+}
+
+func TestDiffArtists(t *testing.T) {
+	prev := snapshot([]models.Artist{
+		{ID: 1, Name: "Queen", Members: []string{"Freddie Mercury", "Brian May"}},
+		{ID: 3, Name: "Gone"},
+	}, nil)
+	next := snapshot([]models.Artist{
+		{ID: 1, Name: "Queen", Members: []string{"Brian May", "Adam Lambert"}},
+	}, nil)
+
+	change := Diff(prev, next)
+	if len(change.ArtistsRemoved) != 1 || change.ArtistsRemoved[0].ID != 3 {
+		t.Errorf("ArtistsRemoved = %v", change.ArtistsRemoved)
+	}
+	if len(change.MembersChanged) != 1 {
+		t.Fatalf("MembersChanged = %v", change.MembersChanged)
+	}
+	members := change.MembersChanged[0]
+	if len(members.Joined) != 1 || members.Joined[0] != "Adam Lambert" || len(members.Left) != 1 || members.Left[0] != "Freddie Mercury" {
+		t.Errorf("member change = %+v", members)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	if err := Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	tracker.subscribers = nil
+	defer Start()()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	artists := []models.Artist{{ID: 1, Name: "Queen"}}
+	for i := 0; i < 3; i++ {
+		artists = append(artists, models.Artist{ID: i + 2, Name: "New"})
+		Observe(models.Snapshot{Time: base.AddDate(0, 0, i), Artists: artists})
+	}
+
+	// The first snapshot is the baseline, then one change per day
+	all := Since(time.Time{})
+	if len(all) != 2 || all[0].ID != 2 || all[1].ID != 1 {
+		t.Fatalf("history = %+v, want changes 2 and 1, newest first", all)
+	}
+	if recent := Since(base.AddDate(0, 0, 1)); len(recent) != 1 || recent[0].ID != 2 {
+		t.Errorf("Since(day 2) = %+v, want only change 2", recent)
+	}
+}
+
+func TestObserveDoesNotWaitForSubscribers(t *testing.T) {
+	if err := Init(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	published := make(chan Change, 2)
+	tracker.subscribers = nil
+	Subscribe(func(c Change) {
+		<-release
+		published <- c
+	})
+	stop := Start()
+
+	artists := []models.Artist{{ID: 1, Name: "Queen"}}
+	Observe(snapshot(artists, nil))
+	for i := 2; i <= 3; i++ {
+		artists = append(artists, models.Artist{ID: i, Name: "New"})
+		observed := make(chan struct{})
+		go func() {
+			Observe(snapshot(artists, nil))
+			close(observed)
+		}()
+		select {
+		case <-observed:
+		case <-time.After(time.Second):
+			t.Fatal("Observe waited for a blocked subscriber")
+		}
+	}
+	if got := len(Since(time.Time{})); got != 2 {
+		t.Errorf("history has %d changes before publishing, want 2", got)
+	}
+
+	close(release)
+	stop()
+	if len(published) != 2 {
+		t.Errorf("published %d changes, want 2", len(published))
+	}
+}
+
+func TestObserveKeepsEveryChange(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	var published []int
+	tracker.subscribers = nil
+	Subscribe(func(c Change) {
+		<-release
+		published = append(published, c.ID)
+	})
+	stop := Start()
+
+	// Far more changes than the subscriber takes in while it is blocked
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	artists := []models.Artist{{ID: 1, Name: "Queen"}}
+	Observe(models.Snapshot{Time: base, Artists: artists})
+	for i := 1; i <= 150; i++ {
+		artists = append(artists, models.Artist{ID: i + 1, Name: "New"})
+		Observe(models.Snapshot{Time: base.Add(time.Duration(i) * time.Minute), Artists: artists})
+	}
+
+	// A snapshot taken before the last one observed changes nothing
+	Observe(models.Snapshot{Time: base, Artists: artists[:1]})
+
+	close(release)
+	stop()
+	if len(published) != 150 {
+		t.Fatalf("published %d changes, want 150", len(published))
+	}
+	for i, id := range published {
+		if id != i+1 {
+			t.Fatalf("change %d published as ID %d, want the changes in order", i+1, id)
+		}
+	}
+
+	// The latest state reached the disk
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tracker.previous.Artists); got != 151 {
+		t.Errorf("saved snapshot has %d artists, want 151", got)
+	}
+	if got := len(Since(time.Time{})); got != 150 {
+		t.Errorf("saved history has %d changes, want 150", got)
+	}
+}
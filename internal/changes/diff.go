@@ -0,0 +1,213 @@
+package changes
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// ArtistRef identifies an artist in a change
+type ArtistRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// ConcertRef identifies one concert date in a change
+type ConcertRef struct {
+	ArtistID   int    `json:"artistId"`
+	ArtistName string `json:"artistName"`
+	Location   string `json:"location"`
+	Date       string `json:"date"`
+}
+
+// MemberChange lists the members that joined or left an artist
+type MemberChange struct {
+	ArtistID int      `json:"artistId"`
+	Name     string   `json:"name"`
+	Joined   []string `json:"joined,omitempty"`
+	Left     []string `json:"left,omitempty"`
+}
+
+// Change is the difference between two snapshots
+type Change struct {
+	ID             int            `json:"id"` // position in the history, starting at 1
+	Time           time.Time      `json:"time"`
+	ArtistsAdded   []ArtistRef    `json:"artistsAdded,omitempty"`
+	ArtistsRemoved []ArtistRef    `json:"artistsRemoved,omitempty"`
+	MembersChanged []MemberChange `json:"membersChanged,omitempty"`
+	DatesAdded     []ConcertRef   `json:"datesAdded,omitempty"`
+	DatesRemoved   []ConcertRef   `json:"datesRemoved,omitempty"`
+}
+
+// Empty reports whether nothing changed
+func (c Change) Empty() bool {
+	return len(c.ArtistsAdded) == 0 && len(c.ArtistsRemoved) == 0 && len(c.MembersChanged) == 0 &&
+		len(c.DatesAdded) == 0 && len(c.DatesRemoved) == 0
+}
+
+// LocationDates is one location of an artist with the dates added and removed there
+type LocationDates struct {
+	ArtistID   int      `json:"artistId"`
+	ArtistName string   `json:"artistName"`
+	Location   string   `json:"location"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+}
+
+// DatesByLocation groups the added and removed dates per artist and location
+func (c Change) DatesByLocation() []LocationDates {
+	var groups []LocationDates
+	index := make(map[string]int)
+	group := func(concert ConcertRef) *LocationDates {
+		key := fmt.Sprintf("%d|%s", concert.ArtistID, concert.Location)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, LocationDates{ArtistID: concert.ArtistID, ArtistName: concert.ArtistName, Location: concert.Location})
+		}
+		return &groups[i]
+	}
+
+	for _, concert := range c.DatesAdded {
+		g := group(concert)
+		g.Added = append(g.Added, concert.Date)
+	}
+	for _, concert := range c.DatesRemoved {
+		g := group(concert)
+		g.Removed = append(g.Removed, concert.Date)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].ArtistName != groups[j].ArtistName {
+			return groups[i].ArtistName < groups[j].ArtistName
+		}
+		return groups[i].Location < groups[j].Location
+	})
+	return groups
+}
+
+// Diff compares two snapshots. Parts missing from either snapshot are not compared.
+func Diff(prev, next models.Snapshot) Change {
+	change := Change{Time: next.Time}
+
+	if prev.Artists != nil && next.Artists != nil {
+		before, after := artistMap(prev.Artists), artistMap(next.Artists)
+		for _, artist := range next.Artists {
+			old, known := before[artist.ID]
+			if !known {
+				change.ArtistsAdded = append(change.ArtistsAdded, ArtistRef{ID: artist.ID, Name: artist.Name})
+				continue
+			}
+			joined, left := difference(artist.Members, old.Members), difference(old.Members, artist.Members)
+			if len(joined) > 0 || len(left) > 0 {
+				change.MembersChanged = append(change.MembersChanged, MemberChange{
+					ArtistID: artist.ID, Name: artist.Name, Joined: joined, Left: left,
+				})
+			}
+		}
+		for _, artist := range prev.Artists {
+			if _, kept := after[artist.ID]; !kept {
+				change.ArtistsRemoved = append(change.ArtistsRemoved, ArtistRef{ID: artist.ID, Name: artist.Name})
+			}
+		}
+
+		sort.Slice(change.ArtistsAdded, func(i, j int) bool {
+			return change.ArtistsAdded[i].ID < change.ArtistsAdded[j].ID
+		})
+		sort.Slice(change.ArtistsRemoved, func(i, j int) bool {
+			return change.ArtistsRemoved[i].ID < change.ArtistsRemoved[j].ID
+		})
+		sort.Slice(change.MembersChanged, func(i, j int) bool {
+			return change.MembersChanged[i].ArtistID < change.MembersChanged[j].ArtistID
+		})
+	}
+
+	if prev.Relations != nil && next.Relations != nil {
+		names := artistNames(prev.Artists, next.Artists)
+		before, after := concertSet(prev.Relations), concertSet(next.Relations)
+		change.DatesAdded = missingFrom(after, before, names)
+		change.DatesRemoved = missingFrom(before, after, names)
+	}
+
+	return change
+}
+
+// concertKey identifies a concert independently of map order and date markers
+type concertKey struct {
+	artistID int
+	location string
+	date     string
+}
+
+func concertSet(relations []models.Relation) map[concertKey]bool {
+	set := make(map[concertKey]bool)
+	for _, relation := range relations {
+		for _, concert := range relation.Concerts() {
+			set[concertKey{concert.ArtistID, concert.Location, concert.Date}] = true
+		}
+	}
+	return set
+}
+
+// missingFrom returns the concerts in a that are not in b, chronologically
+func missingFrom(a, b map[concertKey]bool, names map[int]string) []ConcertRef {
+	var concerts []models.Concert
+	for key := range a {
+		if !b[key] {
+			concerts = append(concerts, models.Concert{ArtistID: key.artistID, Location: key.location, Date: key.date})
+		}
+	}
+	sort.SliceStable(concerts, func(i, j int) bool {
+		return concerts[i].ArtistID < concerts[j].ArtistID
+	})
+	models.SortConcerts(concerts)
+
+	var refs []ConcertRef
+	for _, concert := range concerts {
+		refs = append(refs, ConcertRef{
+			ArtistID:   concert.ArtistID,
+			ArtistName: names[concert.ArtistID],
+			Location:   concert.Location,
+			Date:       concert.Date,
+		})
+	}
+	return refs
+}
+
+// artistMap indexes artists by ID
+func artistMap(artists []models.Artist) map[int]models.Artist {
+	m := make(map[int]models.Artist, len(artists))
+	for _, artist := range artists {
+		m[artist.ID] = artist
+	}
+	return m
+}
+
+// difference returns the values of a that are not in b, in the order of a
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, v := range b {
+		in[v] = true
+	}
+	var out []string
+	for _, v := range a {
+		if !in[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// artistNames maps artist IDs to names, preferring the newer snapshot
+func artistNames(snapshots ...[]models.Artist) map[int]string {
+	names := make(map[int]string)
+	for _, artists := range snapshots {
+		for _, artist := range artists {
+			names[artist.ID] = artist.Name
+		}
+	}
+	return names
+}
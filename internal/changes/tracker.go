@@ -0,0 +1,186 @@
+package changes
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"groupie-tracker/internal/models"
+	"groupie-tracker/internal/storage"
+)
+
+// maxHistory bounds how many changes are kept in the history
+const maxHistory = 200
+
+// Tracker remembers the last snapshot and reports what changed on each refresh
+type Tracker struct {
+	path        string // where the last snapshot is persisted, empty to keep it in memory
+	historyPath string
+	previous    models.Snapshot
+	history     []Change // oldest first
+	subscribers []func(Change)
+	pending     []Change      // observed but not yet passed to the subscribers, oldest first
+	unsaved     bool          // previous and history changed since the last save
+	wake        chan struct{} // tells the Start goroutine there is work
+	mutex       sync.RWMutex
+}
+
+var tracker = &Tracker{wake: make(chan struct{}, 1)}
+
+// Init loads the last snapshot and the change history from the data
+// directory, so changes made upstream while the server was down are still reported
+func Init(dataDir string) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.path = filepath.Join(dataDir, "snapshot.json")
+	tracker.historyPath = filepath.Join(dataDir, "changes.json")
+	tracker.previous = models.Snapshot{}
+	tracker.history = nil
+	tracker.pending, tracker.unsaved = nil, false
+	if _, err := storage.ReadJSON(tracker.path, &tracker.previous); err != nil {
+		return err
+	}
+	_, err := storage.ReadJSON(tracker.historyPath, &tracker.history)
+	return err
+}
+
+// Since returns the changes recorded after t, newest first.
+// The zero time returns the whole history.
+func Since(t time.Time) []Change {
+	tracker.mutex.RLock()
+	defer tracker.mutex.RUnlock()
+
+	var changes []Change
+	for i := len(tracker.history) - 1; i >= 0; i-- {
+		if !tracker.history[i].Time.After(t) {
+			break
+		}
+		changes = append(changes, tracker.history[i])
+	}
+	return changes
+}
+
+// Subscribe registers a function called with every non-empty change
+func Subscribe(subscriber func(Change)) {
+	tracker.mutex.Lock()
+	tracker.subscribers = append(tracker.subscribers, subscriber)
+	tracker.mutex.Unlock()
+}
+
+// Observe diffs a refreshed snapshot against the previous one.
+// The first time a part is seen it only becomes the baseline, so an empty
+// data directory does not report the whole dataset as new. A snapshot older
+// than the last one observed is ignored. Saving and calling the subscribers
+// happen in the Start goroutine, so a slow disk or subscriber does not hold
+// up the refresh that called Observe; snapshots observed meanwhile are
+// saved once, as the latest, and every change is still published in order.
+func Observe(next models.Snapshot) {
+	tracker.mutex.Lock()
+	if next.Time.Before(tracker.previous.Time) {
+		tracker.mutex.Unlock()
+		return
+	}
+	change := Diff(tracker.previous, next)
+
+	// Keep parts the refresh did not include
+	merged := tracker.previous
+	merged.Time = next.Time
+	baseline := false
+	if next.Artists != nil {
+		baseline = baseline || merged.Artists == nil
+		merged.Artists = next.Artists
+	}
+	if next.Relations != nil {
+		baseline = baseline || merged.Relations == nil
+		merged.Relations = next.Relations
+	}
+	tracker.previous = merged
+
+	if change.Empty() && !baseline {
+		tracker.mutex.Unlock()
+		return
+	}
+
+	if !change.Empty() {
+		change.ID = 1
+		if n := len(tracker.history); n > 0 {
+			change.ID = tracker.history[n-1].ID + 1
+		}
+		tracker.history = append(tracker.history, change)
+		if len(tracker.history) > maxHistory {
+			tracker.history = tracker.history[len(tracker.history)-maxHistory:]
+		}
+		tracker.pending = append(tracker.pending, change)
+	}
+	tracker.unsaved = true
+	tracker.mutex.Unlock()
+
+	select {
+	case tracker.wake <- struct{}{}:
+	default: // already woken, it will pick this up too
+	}
+}
+
+// Start saves and publishes the observed changes in the background until
+// the returned function is called, which finishes the pending ones first
+func Start() (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-tracker.wake:
+				publish()
+			case <-done:
+				publish()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// publish saves the latest snapshot and history, if they changed, and
+// passes the pending changes to the subscribers
+func publish() {
+	tracker.mutex.Lock()
+	unsaved, pending := tracker.unsaved, tracker.pending
+	snapshot, history := tracker.previous, append([]Change(nil), tracker.history...)
+	path, historyPath := tracker.path, tracker.historyPath
+	subscribers := append([]func(Change){}, tracker.subscribers...)
+	tracker.unsaved, tracker.pending = false, nil
+	tracker.mutex.Unlock()
+	if !unsaved {
+		return
+	}
+
+	if path != "" {
+		if err := storage.WriteJSON(path, snapshot); err != nil {
+			slog.Error("Saving snapshot failed", "path", path, "err", err)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if historyPath != "" {
+		if err := storage.WriteJSON(historyPath, history); err != nil {
+			slog.Error("Saving change history failed", "path", historyPath, "err", err)
+		}
+	}
+	for _, change := range pending {
+		for _, subscriber := range subscribers {
+			subscriber(change)
+		}
+	}
+}
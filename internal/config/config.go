@@ -0,0 +1,458 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when it exists and no other config file is given
+const DefaultFile = "groupie-tracker.yaml"
+
+// Config is the configuration of the server and the command-line tools.
+// Settings come from, in increasing precedence: defaults, the config file,
+// environment variables and command-line flags.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Upstream  UpstreamConfig  `yaml:"upstream"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Search    SearchConfig    `yaml:"search"`
+	Paths     PathsConfig     `yaml:"paths"`
+	Admin     AdminConfig     `yaml:"admin"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Log       LogConfig       `yaml:"log"`
+	Health    HealthConfig    `yaml:"health"`
+
+	File    string            `yaml:"-"` // config file that was read, empty if none
+	sources map[string]string // where each setting came from, by key
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	Dev             bool          `yaml:"dev"`              // read templates and static files from disk instead of the binary
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // how long in-flight requests may take to finish on shutdown
+	PublicURL       string        `yaml:"public_url"`       // root URL of the site for absolute links, empty for http://localhost:<port>
+}
+
+// SiteURL returns the root URL of the site for absolute links, such as the
+// ones in the feeds, without a trailing slash
+func (s ServerConfig) SiteURL() string {
+	if s.PublicURL == "" {
+		return "http://localhost:" + strconv.Itoa(s.Port)
+	}
+	return strings.TrimSuffix(s.PublicURL, "/")
+}
+
+// UpstreamConfig holds the settings of the artist API
+type UpstreamConfig struct {
+	URL string `yaml:"url"`
+}
+
+// CacheConfig holds the settings of the upstream data cache
+type CacheConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// SearchConfig holds the search settings
+type SearchConfig struct {
+	SuggestionLimit int `yaml:"suggestion_limit"` // default number of location suggestions
+}
+
+// PathsConfig holds the directories and files the server reads and writes
+type PathsConfig struct {
+	Templates    string `yaml:"templates"`
+	Static       string `yaml:"static"`
+	Data         string `yaml:"data"`
+	Aliases      string `yaml:"aliases"`
+	GeoOverrides string `yaml:"geo_overrides"`
+	Webhooks     string `yaml:"webhooks"`
+}
+
+// AdminConfig holds the credentials for the /admin/ endpoints. With neither
+// a token nor a username and password set, every admin request is refused.
+type AdminConfig struct {
+	Token    string `yaml:"token"` // accepted as "Authorization: Bearer <token>"
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Enabled reports whether any admin credentials are configured
+func (a AdminConfig) Enabled() bool {
+	return a.Token != "" || a.Username != ""
+}
+
+// RateLimitConfig holds the request budgets of each client. A client may
+// make burst requests at once and then per_minute requests a minute; a
+// per_minute of 0 turns the limit off.
+type RateLimitConfig struct {
+	SearchPerMinute int      `yaml:"search_per_minute"` // /search and the location search and suggestion APIs
+	SearchBurst     int      `yaml:"search_burst"`
+	APIPerMinute    int      `yaml:"api_per_minute"` // the other /api/ endpoints
+	APIBurst        int      `yaml:"api_burst"`
+	TrustedProxies  []string `yaml:"trusted_proxies"` // addresses or CIDR ranges whose X-Forwarded-For is believed
+}
+
+// Proxies parses the trusted proxies into address ranges
+func (r RateLimitConfig) Proxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range r.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	Format string `yaml:"format"` // text or json
+	Level  string `yaml:"level"`  // debug, info, warn or error
+}
+
+// HealthConfig holds the settings of the readiness check
+type HealthConfig struct {
+	MaxStaleness time.Duration `yaml:"max_staleness"` // oldest dataset that still counts as ready
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Port: 8080, ShutdownTimeout: 15 * time.Second},
+		Upstream: UpstreamConfig{URL: "https://groupietrackers.herokuapp.com/api"},
+		Cache:    CacheConfig{TTL: 5 * time.Minute},
+		Search:   SearchConfig{SuggestionLimit: 5},
+		RateLimit: RateLimitConfig{
+			SearchPerMinute: 120,
+			SearchBurst:     30,
+			APIPerMinute:    600,
+			APIBurst:        120,
+		},
+		Log:    LogConfig{Format: "text", Level: "info"},
+		Health: HealthConfig{MaxStaleness: 15 * time.Minute},
+		Paths: PathsConfig{
+			Templates:    "internal/templates",
+			Static:       "static",
+			Data:         "data",
+			Aliases:      "aliases.json",
+			GeoOverrides: "geo_overrides.json",
+			Webhooks:     "webhooks.json",
+		},
+	}
+}
+
+// setting ties a config file key to its environment variable and flag
+type setting struct {
+	key   string // dotted key in the config file
+	env   string
+	flag  string
+	usage string
+	field func(c *Config) interface{} // pointer to the field
+}
+
+var settings = []setting{
+	{"server.port", "PORT", "port", "port to listen on", func(c *Config) interface{} { return &c.Server.Port }},
+	{"server.dev", "GROUPIE_DEV", "dev", "read templates and static files from the paths below instead of the binary", func(c *Config) interface{} { return &c.Server.Dev }},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long in-flight requests may take to finish on shutdown, e.g. 15s", func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{"server.public_url", "PUBLIC_URL", "public-url", "root URL the site is reached at, for feed links; empty for http://localhost:<port>", func(c *Config) interface{} { return &c.Server.PublicURL }},
+	{"upstream.url", "UPSTREAM_URL", "upstream-url", "root URL of the artist API", func(c *Config) interface{} { return &c.Upstream.URL }},
+	{"cache.ttl", "CACHE_TTL", "cache-ttl", "how long upstream data is cached, e.g. 5m", func(c *Config) interface{} { return &c.Cache.TTL }},
+	{"search.suggestion_limit", "SUGGESTION_LIMIT", "suggestion-limit", "default number of location suggestions", func(c *Config) interface{} { return &c.Search.SuggestionLimit }},
+	{"paths.templates", "TEMPLATES_DIR", "templates", "directory of the HTML templates", func(c *Config) interface{} { return &c.Paths.Templates }},
+	{"paths.static", "STATIC_DIR", "static", "directory of the static files", func(c *Config) interface{} { return &c.Paths.Static }},
+	{"paths.data", "DATA_DIR", "data-dir", "directory for snapshots, feeds and change history", func(c *Config) interface{} { return &c.Paths.Data }},
+	{"paths.aliases", "ALIASES_FILE", "aliases", "JSON file of search aliases", func(c *Config) interface{} { return &c.Paths.Aliases }},
+	{"paths.geo_overrides", "GEO_OVERRIDES_FILE", "geo-overrides", "JSON file of location coordinates", func(c *Config) interface{} { return &c.Paths.GeoOverrides }},
+	{"paths.webhooks", "WEBHOOKS_FILE", "webhooks", "JSON file of webhook subscriptions", func(c *Config) interface{} { return &c.Paths.Webhooks }},
+	{"admin.token", "ADMIN_TOKEN", "admin-token", "bearer token for the /admin/ endpoints", func(c *Config) interface{} { return &c.Admin.Token }},
+	{"admin.username", "ADMIN_USERNAME", "admin-username", "basic auth username for the /admin/ endpoints", func(c *Config) interface{} { return &c.Admin.Username }},
+	{"admin.password", "ADMIN_PASSWORD", "admin-password", "basic auth password for the /admin/ endpoints", func(c *Config) interface{} { return &c.Admin.Password }},
+	{"rate_limit.search_per_minute", "SEARCH_RATE_LIMIT", "search-rate-limit", "search requests a minute each client may make, 0 for no limit", func(c *Config) interface{} { return &c.RateLimit.SearchPerMinute }},
+	{"rate_limit.search_burst", "SEARCH_BURST", "search-burst", "search requests each client may make at once", func(c *Config) interface{} { return &c.RateLimit.SearchBurst }},
+	{"rate_limit.api_per_minute", "API_RATE_LIMIT", "api-rate-limit", "API requests a minute each client may make, 0 for no limit", func(c *Config) interface{} { return &c.RateLimit.APIPerMinute }},
+	{"rate_limit.api_burst", "API_BURST", "api-burst", "API requests each client may make at once", func(c *Config) interface{} { return &c.RateLimit.APIBurst }},
+	{"rate_limit.trusted_proxies", "TRUSTED_PROXIES", "trusted-proxies", "comma-separated addresses or CIDR ranges of proxies whose X-Forwarded-For is believed", func(c *Config) interface{} { return &c.RateLimit.TrustedProxies }},
+	{"log.format", "LOG_FORMAT", "log-format", "log format, text or json", func(c *Config) interface{} { return &c.Log.Format }},
+	{"log.level", "LOG_LEVEL", "log-level", "lowest level logged: debug, info, warn or error", func(c *Config) interface{} { return &c.Log.Level }},
+	{"health.max_staleness", "MAX_STALENESS", "max-staleness", "age of the upstream data after which /readyz fails, e.g. 15m", func(c *Config) interface{} { return &c.Health.MaxStaleness }},
+}
+
+// secrets are the settings whose values are never printed
+var secrets = map[string]bool{"admin.token": true, "admin.password": true}
+
+// set parses a string into the setting's field
+func (s setting) set(c *Config, value string) error {
+	value = strings.TrimSpace(value)
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *int:
+		if s.key == "server.port" {
+			value = strings.TrimPrefix(value, ":") // PORT used to accept ":8080"
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field = b
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 5m", value)
+		}
+		*field = d
+	}
+	return nil
+}
+
+// Loader collects the config flags of a command line
+type Loader struct {
+	file  string
+	flags map[string]string // flag name to value, for flags given on the command line
+}
+
+// NewLoader registers -config and a flag for every setting on fs
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{flags: make(map[string]string)}
+	fs.StringVar(&l.file, "config", "", "config file (default $CONFIG_FILE or "+DefaultFile+" if it exists)")
+	for _, s := range settings {
+		name := s.flag
+		record := func(value string) error {
+			l.flags[name] = value
+			return nil
+		}
+		if _, isBool := s.field(&Config{}).(*bool); isBool {
+			fs.BoolFunc(name, s.usage+" ($"+s.env+")", record)
+		} else {
+			fs.Func(name, s.usage+" ($"+s.env+")", record)
+		}
+	}
+	return l
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment (looked up with getenv) and the parsed flags, then validates it
+func (l *Loader) Load(getenv func(string) string) (*Config, error) {
+	c := Default()
+	c.sources = make(map[string]string)
+	for _, s := range settings {
+		c.sources[s.key] = "default"
+	}
+
+	path, explicit := l.file, l.file != ""
+	if !explicit {
+		path = getenv("CONFIG_FILE")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = DefaultFile
+	}
+	if err := c.readFile(path, explicit); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := s.set(c, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (from $%s): %v", s.key, s.env, err))
+			}
+			c.sources[s.key] = "env " + s.env
+		}
+	}
+	for _, s := range settings {
+		if value, ok := l.flags[s.flag]; ok {
+			if err := s.set(c, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (from -%s): %v", s.key, s.flag, err))
+			}
+			c.sources[s.key] = "flag -" + s.flag
+		}
+	}
+	if len(problems) == 0 {
+		problems = c.validate()
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return c, nil
+}
+
+// readFile merges a YAML config file into c. A missing file is only an
+// error when it was asked for explicitly.
+func (c *Config) readFile(path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	// Decode into a copy first so unknown keys and bad values leave c untouched
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	merged := *c
+	if err := decoder.Decode(&merged); err != nil && err != io.EOF {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// Remember which settings the file set
+	var raw map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err == nil {
+		for section, values := range raw {
+			for key := range values {
+				c.sources[section+"."+key] = "file " + path
+			}
+		}
+	}
+
+	merged.File = path
+	*c = merged
+	return nil
+}
+
+// validate returns a description of each invalid setting
+func (c *Config) validate() []string {
+	var problems []string
+	report := func(key, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s (from %s): %s", key, c.sources[key], fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		report("server.port", "%d is not between 1 and 65535", c.Server.Port)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		report("server.shutdown_timeout", "must be positive, got %s", c.Server.ShutdownTimeout)
+	}
+	if c.Server.PublicURL != "" {
+		if u, err := url.Parse(c.Server.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report("server.public_url", "%q is not an http or https URL", c.Server.PublicURL)
+		}
+	}
+	if u, err := url.Parse(c.Upstream.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		report("upstream.url", "%q is not an http or https URL", c.Upstream.URL)
+	}
+	if c.Cache.TTL <= 0 {
+		report("cache.ttl", "must be positive, got %s", c.Cache.TTL)
+	}
+	if c.Health.MaxStaleness <= c.Cache.TTL {
+		report("health.max_staleness", "must be longer than cache.ttl (%s), got %s", c.Cache.TTL, c.Health.MaxStaleness)
+	}
+	if c.Search.SuggestionLimit < 1 || c.Search.SuggestionLimit > 100 {
+		report("search.suggestion_limit", "%d is not between 1 and 100", c.Search.SuggestionLimit)
+	}
+	if (c.Admin.Username == "") != (c.Admin.Password == "") {
+		report("admin.username", "the admin username and password must be set together")
+	}
+	for _, limit := range []struct {
+		key       string
+		perMinute int
+		burstKey  string
+		burst     int
+	}{
+		{"rate_limit.search_per_minute", c.RateLimit.SearchPerMinute, "rate_limit.search_burst", c.RateLimit.SearchBurst},
+		{"rate_limit.api_per_minute", c.RateLimit.APIPerMinute, "rate_limit.api_burst", c.RateLimit.APIBurst},
+	} {
+		if limit.perMinute < 0 {
+			report(limit.key, "must not be negative, got %d", limit.perMinute)
+		}
+		if limit.perMinute > 0 && limit.burst < 1 {
+			report(limit.burstKey, "must be at least 1, got %d", limit.burst)
+		}
+	}
+	if _, err := c.RateLimit.Proxies(); err != nil {
+		report("rate_limit.trusted_proxies", "%v", err)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		report("log.format", "%q is not text or json", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		report("log.level", "%q is not debug, info, warn or error", c.Log.Level)
+	}
+	paths := map[string]string{
+		"paths.templates":     c.Paths.Templates,
+		"paths.static":        c.Paths.Static,
+		"paths.data":          c.Paths.Data,
+		"paths.aliases":       c.Paths.Aliases,
+		"paths.geo_overrides": c.Paths.GeoOverrides,
+		"paths.webhooks":      c.Paths.Webhooks,
+	}
+	for _, s := range settings {
+		if path, ok := paths[s.key]; ok && path == "" {
+			report(s.key, "must not be empty")
+		}
+	}
+	return problems
+}
+
+// Source returns where a setting came from: default, "file <path>",
+// "env <NAME>" or "flag -<name>"
+func (c *Config) Source(key string) string {
+	return c.sources[key]
+}
+
+// Write prints the configuration as YAML, with the source of each setting
+// and the environment variable and flag that set it as a comment
+func (c *Config) Write(w io.Writer) error {
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		section, values := doc.Content[i].Value, doc.Content[i+1]
+		for j := 0; j+1 < len(values.Content); j += 2 {
+			key, value := section+"."+values.Content[j].Value, values.Content[j+1]
+			if secrets[key] && value.Value != "" {
+				value.Value, value.Style = "********", 0
+			}
+			value.LineComment = c.Source(key)
+			if s, ok := byKey[key]; ok {
+				value.LineComment += "; $" + s.env + ", -" + s.flag
+			}
+		}
+	}
+
+	if c.File != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.File)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load parses args and loads the configuration with the given environment
+func load(t *testing.T, env map[string]string, args ...string) (*Config, error) {
+	t.Helper()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return loader.Load(func(name string) string { return env[name] })
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: 9000
+cache:
+  ttl: 1m
+search:
+  suggestion_limit: 8
+`)
+	env := map[string]string{"CONFIG_FILE": path, "PORT": ":9100", "CACHE_TTL": "2m"}
+
+	cfg, err := load(t, env, "-port", "9200", "-dev", "-trusted-proxies", "10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9200 || cfg.Source("server.port") != "flag -port" {
+		t.Errorf("port = %d from %s, want the flag", cfg.Server.Port, cfg.Source("server.port"))
+	}
+	if cfg.Cache.TTL != 2*time.Minute || cfg.Source("cache.ttl") != "env CACHE_TTL" {
+		t.Errorf("ttl = %s from %s, want the env var", cfg.Cache.TTL, cfg.Source("cache.ttl"))
+	}
+	if cfg.Search.SuggestionLimit != 8 || cfg.Source("search.suggestion_limit") != "file "+path {
+		t.Errorf("suggestion limit = %d from %s, want the file", cfg.Search.SuggestionLimit, cfg.Source("search.suggestion_limit"))
+	}
+	if !cfg.Server.Dev || cfg.Source("server.dev") != "flag -dev" {
+		t.Errorf("dev = %v from %s, want the flag", cfg.Server.Dev, cfg.Source("server.dev"))
+	}
+	if proxies, _ := cfg.RateLimit.Proxies(); len(proxies) != 2 || proxies[1].String() != "192.168.1.1/32" {
+		t.Errorf("trusted proxies = %v, want 10.0.0.0/8 and 192.168.1.1/32", proxies)
+	}
+	if cfg.Paths.Templates != "internal/templates" || cfg.Source("paths.templates") != "default" {
+		t.Errorf("templates = %q from %s, want the default", cfg.Paths.Templates, cfg.Source("paths.templates"))
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	env := map[string]string{"UPSTREAM_URL": "ftp://example.com", "ADMIN_USERNAME": "admin", "TRUSTED_PROXIES": "10.0.0.0/8, proxy.local",
+		"PUBLIC_URL": "groupie.example.com"}
+	_, err := load(t, env, "-port", "0", "-suggestion-limit", "500", "-shutdown-timeout", "0s", "-search-burst", "0")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"server.port (from flag -port): 0 is not between 1 and 65535",
+		`upstream.url (from env UPSTREAM_URL): "ftp://example.com" is not an http or https URL`,
+		`server.public_url (from env PUBLIC_URL): "groupie.example.com" is not an http or https URL`,
+		"search.suggestion_limit (from flag -suggestion-limit): 500 is not between 1 and 100",
+		"server.shutdown_timeout (from flag -shutdown-timeout): must be positive, got 0s",
+		"admin.username (from env ADMIN_USERNAME): the admin username and password must be set together",
+		"rate_limit.search_burst (from flag -search-burst): must be at least 1, got 0",
+		`rate_limit.trusted_proxies (from env TRUSTED_PROXIES): "proxy.local" is not an IP address or CIDR range`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	if _, err := load(t, nil, "-cache-ttl", "soon"); err == nil || !strings.Contains(err.Error(), "not a duration") {
+		t.Errorf("bad duration: %v", err)
+	}
+}
+
+func TestSiteURL(t *testing.T) {
+	for server, want := range map[ServerConfig]string{
+		{Port: 8080}: "http://localhost:8080",
+		{Port: 8080, PublicURL: "https://groupie.example.com/"}: "https://groupie.example.com",
+	} {
+		if got := server.SiteURL(); got != want {
+			t.Errorf("SiteURL of %+v = %q, want %q", server, got, want)
+		}
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	path := writeFile(t, "server:\n  prot: 9000\n")
+	if _, err := load(t, nil, "-config", path); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("unknown key: %v", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := load(t, nil, "-config", missing); err == nil {
+		t.Error("expected an error for a missing explicit config file")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	cfg, err := load(t, map[string]string{"DATA_DIR": "/var/lib/groupie", "ADMIN_TOKEN": "s3cret", "GROUPIE_DEV": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"port: 8080 # default; $PORT, -port",
+		"dev: true # env GROUPIE_DEV; $GROUPIE_DEV, -dev",
+		"ttl: 5m0s # default",
+		"data: /var/lib/groupie # env DATA_DIR",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, "trusted_proxies: [] # default") {
+		t.Errorf("output does not list the trusted proxies:\n%s", out)
+	}
+	if strings.Contains(out, "s3cret") || !strings.Contains(out, "token: '********' # env ADMIN_TOKEN") {
+		t.Errorf("output does not hide the admin token:\n%s", out)
+	}
+}
@@ -0,0 +1,264 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"groupie-tracker/internal/geo"
+	"groupie-tracker/internal/models"
+)
+
+// Column is one field of an export. Type is one of integer, number, string,
+// date (yyyy-mm-dd) or list (a JSON array, joined with "; " in CSV and XLSX).
+type Column struct {
+	Name string
+	Type string
+}
+
+// listSeparator joins list values in CSV and XLSX cells
+const listSeparator = "; "
+
+// ArtistColumns is the schema of the artists export
+var ArtistColumns = []Column{
+	{"id", "integer"},
+	{"name", "string"},
+	{"members", "list"},
+	{"member_count", "integer"},
+	{"creation_date", "integer"},
+	{"first_album", "date"},
+	{"concert_count", "integer"},
+}
+
+// ConcertColumns is the schema of the concerts export, one row per concert
+var ConcertColumns = []Column{
+	{"artist_id", "integer"},
+	{"artist", "string"},
+	{"city", "string"},
+	{"country", "string"},
+	{"date", "date"},
+	{"latitude", "number"},
+	{"longitude", "number"},
+}
+
+// Formats lists the supported export formats
+var Formats = []string{"csv", "jsonl", "xlsx"}
+
+// Datasets maps the name of each export to its columns
+var Datasets = map[string][]Column{
+	"artists":  ArtistColumns,
+	"concerts": ConcertColumns,
+}
+
+// Schema describes columns as "name:type,..." for the response headers
+func Schema(columns []Column) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = column.Name + ":" + column.Type
+	}
+	return strings.Join(parts, ",")
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case "csv":
+		return "text/csv; charset=utf-8; header=present"
+	case "jsonl":
+		return "application/jsonl; charset=utf-8"
+	case "xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return ""
+}
+
+// ArtistRow returns the values of an artist in ArtistColumns order
+func ArtistRow(artist models.Artist, concertCount int) []interface{} {
+	return []interface{}{
+		artist.ID,
+		artist.Name,
+		artist.Members,
+		len(artist.Members),
+		artist.CreationDate,
+		models.ISODate(artist.FirstAlbum),
+		concertCount,
+	}
+}
+
+// ConcertRow returns the values of a concert in ConcertColumns order.
+// Unknown coordinates are left empty.
+func ConcertRow(artist models.Artist, concert models.Concert) []interface{} {
+	var lat, lon interface{}
+	if concert.Coordinates != nil {
+		lat, lon = concert.Coordinates.Lat, concert.Coordinates.Lon
+	}
+	return []interface{}{
+		artist.ID,
+		artist.Name,
+		concert.City,
+		concert.Country,
+		models.ISODate(concert.Date),
+		lat,
+		lon,
+	}
+}
+
+// Writer streams rows of an export
+type Writer interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// NewWriter starts an export in the given format. CSV and XLSX begin with a
+// header row of column names.
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case "csv":
+		cw := &csvWriter{w: csv.NewWriter(w)}
+		header := make([]interface{}, len(columns))
+		for i, column := range columns {
+			header[i] = column.Name
+		}
+		return cw, cw.WriteRow(header)
+	case "jsonl":
+		return &jsonlWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case "xlsx":
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// Write streams a dataset ("artists" or "concerts") of the given artists in a format
+func Write(w io.Writer, dataset, format string, artists []models.Artist, relations []models.Relation) error {
+	columns, ok := Datasets[dataset]
+	if !ok {
+		return fmt.Errorf("unknown export dataset %q", dataset)
+	}
+	writer, err := NewWriter(format, w, columns)
+	if err != nil {
+		return err
+	}
+
+	relationMap := make(map[int]models.Relation)
+	for _, relation := range relations {
+		relationMap[relation.ID] = relation
+	}
+
+	for _, artist := range artists {
+		concerts := relationMap[artist.ID].Concerts()
+		if dataset == "artists" {
+			if err := writer.WriteRow(ArtistRow(artist, len(concerts))); err != nil {
+				return err
+			}
+			continue
+		}
+
+		geo.Locate(concerts)
+		for _, concert := range concerts {
+			if err := writer.WriteRow(ConcertRow(artist, concert)); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
+
+// cellText formats a value for CSV and XLSX cells
+func cellText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		return strings.Join(v, listSeparator)
+	}
+	return fmt.Sprint(value)
+}
+
+// safeText prefixes CSV text a spreadsheet would run as a formula with a
+// quote, so an upstream name like "=HYPERLINK(...)" is shown as written.
+// XLSX cells are inline strings, which are never run, and need nothing.
+func safeText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+type csvWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func (cw *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch value.(type) {
+		case int, float64: // numbers stay numbers, negative coordinates included
+			record[i] = cellText(value)
+		default:
+			record[i] = safeText(cellText(value))
+		}
+	}
+	if err := cw.w.Write(record); err != nil {
+		return err
+	}
+
+	// Flush now and then so large exports reach the client while they are written
+	cw.rows++
+	if cw.rows%100 == 0 {
+		cw.w.Flush()
+		return cw.w.Error()
+	}
+	return nil
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []Column
+}
+
+// WriteRow writes one JSON object with the keys in column order
+func (jw *jsonlWriter) WriteRow(values []interface{}) error {
+	jw.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(jw.columns[i].Name)
+		if list, ok := value.([]string); ok && list == nil {
+			value = []string{}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		jw.w.Write(key)
+		jw.w.WriteByte(':')
+		jw.w.Write(data)
+	}
+	jw.w.WriteString("}\n")
+
+	if jw.w.Buffered() > 32*1024 {
+		return jw.w.Flush()
+	}
+	return nil
+}
+
+func (jw *jsonlWriter) Close() error {
+	return jw.w.Flush()
+}
@@ -0,0 +1,196 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"groupie-tracker/internal/models"
+)
+
+var testArtist = models.Artist{
+	ID:           4,
+	Name:         `Guns "N" Roses`,
+	Members:      []string{"Axl Rose", "Slash, the guitarist", "Duff\nMcKagan"},
+	CreationDate: 1985,
+	FirstAlbum:   "21-07-1987",
+}
+
+func writeAll(t *testing.T, format string, columns []Column, rows ...[]interface{}) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(format, &buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVQuotesMemberLists(t *testing.T) {
+	data := writeAll(t, "csv", ArtistColumns, ArtistRow(testArtist, 12))
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want header and one row", len(records))
+	}
+	if got := strings.Join(records[0], ","); got != "id,name,members,member_count,creation_date,first_album,concert_count" {
+		t.Errorf("header = %q", got)
+	}
+	want := []string{"4", `Guns "N" Roses`, "Axl Rose; Slash, the guitarist; Duff\nMcKagan", "3", "1985", "1987-07-21", "12"}
+	for i := range want {
+		if records[1][i] != want[i] {
+			t.Errorf("column %s = %q, want %q", ArtistColumns[i].Name, records[1][i], want[i])
+		}
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	located := models.Concert{City: "Los Angeles", Country: "Usa", Date: "*22-08-2019", Coordinates: &models.Coordinates{Lat: 34.05, Lon: -118.24}}
+	unknown := models.Concert{City: "Nowhere", Country: "Usa", Date: "01-01-2020"}
+	data := writeAll(t, "jsonl", ConcertColumns, ConcertRow(testArtist, located), ConcertRow(testArtist, unknown))
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := []string{
+		`{"artist_id":4,"artist":"Guns \"N\" Roses","city":"Los Angeles","country":"Usa","date":"2019-08-22","latitude":34.05,"longitude":-118.24}`,
+		`{"artist_id":4,"artist":"Guns \"N\" Roses","city":"Nowhere","country":"Usa","date":"2020-01-01","latitude":null,"longitude":null}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d:\n got %s\nwant %s", i+1, lines[i], want[i])
+		}
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := writeAll(t, "xlsx", ArtistColumns, ArtistRow(testArtist, 12))
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			R     string `xml:"r,attr"`
+			Cells []struct {
+				R      string `xml:"r,attr"`
+				T      string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(sheet.Rows))
+	}
+	cells := sheet.Rows[1].Cells
+	if cells[0].R != "A2" || cells[0].Value != "4" || cells[0].T != "" {
+		t.Errorf("id cell = %+v, want the number 4 in A2", cells[0])
+	}
+	if cells[1].T != "inlineStr" || cells[1].Inline != `Guns "N" Roses` {
+		t.Errorf("name cell = %+v", cells[1])
+	}
+	if cells[2].Inline != "Axl Rose; Slash, the guitarist; Duff\nMcKagan" {
+		t.Errorf("members cell = %q", cells[2].Inline)
+	}
+}
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	row := []interface{}{7, "=HYPERLINK(\"http://evil.example\")", []string{"+1", "Bob"}, "-x", "@SUM(A1)", -58.38, "Queen"}
+	want := []string{"7", "'=HYPERLINK(\"http://evil.example\")", "'+1; Bob", "'-x", "'@SUM(A1)", "-58.38", "Queen"}
+
+	records, err := csv.NewReader(bytes.NewReader(writeAll(t, "csv", make([]Column, len(row)), row))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if records[1][i] != want[i] {
+			t.Errorf("column %d = %q, want %q", i, records[1][i], want[i])
+		}
+	}
+}
+
+func TestXLSXKeepsFormulaLikeText(t *testing.T) {
+	row := []interface{}{"-M-", "=1+2", []string{"+1", "Bob"}, "@home", -58.38}
+	want := []string{"-M-", "=1+2", "+1; Bob", "@home", "-58.38"}
+
+	data := writeAll(t, "xlsx", make([]Column, len(row)), row)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = xml.NewDecoder(rc).Decode(&sheet)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sheet.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(sheet.Rows))
+	}
+	for i, cell := range sheet.Rows[1].Cells {
+		if got := cell.Value + cell.Inline; got != want[i] {
+			t.Errorf("column %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package feeds
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"groupie-tracker/internal/changes"
+	"groupie-tracker/internal/storage"
+)
+
+// Entry kinds
+const (
+	KindArtistAdded = "artist-added"
+	KindDateAdded   = "date-added"
+	KindDateRemoved = "date-removed"
+)
+
+// maxEntries bounds how many entries are kept and persisted
+const maxEntries = 500
+
+// Entry is one item of a feed
+type Entry struct {
+	ID      string    `json:"id"` // tag URI, never changes once published
+	Kind    string    `json:"kind"`
+	Title   string    `json:"title"`
+	Summary string    `json:"summary"`
+	Path    string    `json:"path"` // link relative to the site root
+	Updated time.Time `json:"updated"`
+}
+
+// Store keeps feed entries, newest first, and persists them to disk
+type Store struct {
+	path    string // empty to keep entries in memory only
+	entries []Entry
+	mutex   sync.RWMutex
+}
+
+var store = &Store{}
+
+// Init loads persisted entries from the data directory
+func Init(dataDir string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.path = filepath.Join(dataDir, "feeds.json")
+	store.entries = nil
+	_, err := storage.ReadJSON(store.path, &store.entries)
+	return err
+}
+
+// tagURI builds a stable RFC 4151 ID from the date the change was seen
+func tagURI(seen time.Time, format string, args ...interface{}) string {
+	return "tag:groupie-tracker," + seen.UTC().Format("2006-01-02") + ":" + fmt.Sprintf(format, args...)
+}
+
+// locationSlug turns "New York Usa" into "new-york-usa" for IDs
+func locationSlug(location string) string {
+	return strings.ToLower(strings.Join(strings.Fields(location), "-"))
+}
+
+// Record adds the entries for a change and persists the store
+func Record(change changes.Change) {
+	var entries []Entry
+	for _, artist := range change.ArtistsAdded {
+		entries = append(entries, Entry{
+			ID:      tagURI(change.Time, "artist/%d", artist.ID),
+			Kind:    KindArtistAdded,
+			Title:   "New artist: " + artist.Name,
+			Summary: artist.Name + " was added to Groupie Tracker.",
+			Path:    fmt.Sprintf("/artist/%d", artist.ID),
+			Updated: change.Time,
+		})
+	}
+	for _, concert := range change.DatesAdded {
+		entries = append(entries, Entry{
+			ID:      tagURI(change.Time, "concert/%d/%s/%s/added", concert.ArtistID, locationSlug(concert.Location), concert.Date),
+			Kind:    KindDateAdded,
+			Title:   fmt.Sprintf("%s: new date in %s on %s", concert.ArtistName, concert.Location, concert.Date),
+			Summary: fmt.Sprintf("%s added a concert in %s on %s.", concert.ArtistName, concert.Location, concert.Date),
+			Path:    fmt.Sprintf("/artist/%d", concert.ArtistID),
+			Updated: change.Time,
+		})
+	}
+	for _, concert := range change.DatesRemoved {
+		entries = append(entries, Entry{
+			ID:      tagURI(change.Time, "concert/%d/%s/%s/removed", concert.ArtistID, locationSlug(concert.Location), concert.Date),
+			Kind:    KindDateRemoved,
+			Title:   fmt.Sprintf("%s: date in %s on %s removed", concert.ArtistName, concert.Location, concert.Date),
+			Summary: fmt.Sprintf("The concert of %s in %s on %s is no longer listed.", concert.ArtistName, concert.Location, concert.Date),
+			Path:    fmt.Sprintf("/artist/%d", concert.ArtistID),
+			Updated: change.Time,
+		})
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Newest first, an ID seen again replaces the older entry
+	fresh := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		fresh[entry.ID] = true
+	}
+	for _, entry := range store.entries {
+		if !fresh[entry.ID] {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > maxEntries {
+		entries = entries[:maxEntries]
+	}
+	store.entries = entries
+
+	if store.path != "" {
+		if err := storage.WriteJSON(store.path, store.entries); err != nil {
+			slog.Error("Saving feeds failed", "path", store.path, "err", err)
+		}
+	}
+}
+
+// Entries returns the entries of the given kinds, newest first
+func Entries(kinds ...string) []Entry {
+	wanted := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		wanted[kind] = true
+	}
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var entries []Entry
+	for _, entry := range store.entries {
+		if wanted[entry.Kind] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// lastUpdated returns when the newest entry was published
+func lastUpdated(entries []Entry) time.Time {
+	if len(entries) == 0 {
+		return time.Unix(0, 0).UTC()
+	}
+	return entries[0].Updated
+}
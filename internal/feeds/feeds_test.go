@@ -0,0 +1,60 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/changes"
+)
+
+func TestRecordAndFeeds(t *testing.T) {
+	dir := t.TempDir()
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	change := changes.Change{
+		Time:         seen,
+		ArtistsAdded: []changes.ArtistRef{{ID: 2, Name: "AC/DC"}},
+		DatesAdded:   []changes.ConcertRef{{ArtistID: 2, ArtistName: "AC/DC", Location: "New York Usa", Date: "03-08-1988"}},
+	}
+	Record(change)
+	Record(change) // the same change again must not duplicate entries
+
+	// Entries survive a restart
+	if err := Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	entries := Entries(KindArtistAdded, KindDateAdded, KindDateRemoved)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if id := entries[1].ID; id != "tag:groupie-tracker,2024-03-01:concert/2/new-york-usa/03-08-1988/added" {
+		t.Errorf("unexpected entry ID %q", id)
+	}
+
+	var atom bytes.Buffer
+	if err := WriteAtom(&atom, "New artists", "http://example.com", "/feeds/artists.atom", Entries(KindArtistAdded)); err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(atom.Bytes(), &feed); err != nil {
+		t.Fatalf("invalid Atom: %v\n%s", err, atom.String())
+	}
+	if len(feed.Entries) != 1 || feed.Entries[0].Link.Href != "http://example.com/artist/2" || feed.Updated != "2024-03-01T12:00:00Z" ||
+		feed.ID != "tag:groupie-tracker,2024:feeds/artists.atom" {
+		t.Errorf("unexpected Atom feed: %+v", feed)
+	}
+
+	var rss bytes.Buffer
+	if err := WriteRSS(&rss, "Concerts", "http://example.com", "Updates", entries); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rss.String(), `<guid isPermaLink="false">tag:groupie-tracker,2024-03-01:artist/2</guid>`) {
+		t.Errorf("RSS is missing the artist GUID:\n%s", rss.String())
+	}
+}
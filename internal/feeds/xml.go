@@ -0,0 +1,129 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// feedID returns the stable RFC 4151 ID of a feed, the same whichever host
+// it is fetched through
+func feedID(selfPath string) string {
+	return "tag:groupie-tracker,2024:" + strings.TrimPrefix(selfPath, "/")
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+// WriteAtom writes entries as an Atom 1.0 feed. siteURL is the configured
+// absolute site root, used for the links only.
+func WriteAtom(w io.Writer, title, siteURL, selfPath string, entries []Entry) error {
+	feed := atomFeed{
+		Title:   title,
+		ID:      feedID(selfPath),
+		Updated: lastUpdated(entries).Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: siteURL + selfPath, Rel: "self", Type: "application/atom+xml"},
+			{Href: siteURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Author: atomAuthor{Name: "Groupie Tracker"},
+	}
+	for _, entry := range entries {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   entry.Title,
+			ID:      entry.ID,
+			Updated: entry.Updated.Format(time.RFC3339),
+			Link:    atomLink{Href: siteURL + entry.Path, Rel: "alternate"},
+			Summary: entry.Summary,
+		})
+	}
+	return writeXML(w, feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// WriteRSS writes entries as an RSS 2.0 feed. siteURL is the configured
+// absolute site root.
+func WriteRSS(w io.Writer, title, siteURL, description string, entries []Entry) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          siteURL + "/",
+			Description:   description,
+			LastBuildDate: lastUpdated(entries).Format(time.RFC1123Z),
+		},
+	}
+	for _, entry := range entries {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       entry.Title,
+			Link:        siteURL + entry.Path,
+			GUID:        rssGUID{Value: entry.ID},
+			PubDate:     entry.Updated.Format(time.RFC1123Z),
+			Description: entry.Summary,
+			Category:    entry.Kind,
+		})
+	}
+	return writeXML(w, feed)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,189 @@
+package geo
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"groupie-tracker/internal/models"
+)
+
+// The bundled gazetteer, so lookups never need the network
+//
+//go:embed gazetteer.csv
+var gazetteerData string
+
+// Gazetteer resolves cleaned location names to coordinates
+type Gazetteer struct {
+	entries       map[string]models.Coordinates // normalized location -> coordinates
+	overrides     map[string]models.Coordinates // normalized location -> coordinates
+	overridesPath string
+	misses        map[string]bool // locations already reported as unknown
+	mutex         sync.RWMutex
+}
+
+var (
+	defaultGazetteer *Gazetteer
+	loadOnce         sync.Once
+)
+
+// gazetteer returns the shared gazetteer, loading it on first use
+func gazetteer() *Gazetteer {
+	loadOnce.Do(func() {
+		entries, err := parseGazetteer(gazetteerData)
+		if err != nil {
+			// The file is bundled, so this is a programming error
+			slog.Error("Parsing bundled gazetteer failed", "err", err)
+			os.Exit(1)
+		}
+		defaultGazetteer = &Gazetteer{
+			entries:       entries,
+			overrides:     make(map[string]models.Coordinates),
+			overridesPath: defaultOverridesFile(),
+			misses:        make(map[string]bool),
+		}
+		if err := defaultGazetteer.loadOverrides(); err != nil {
+			slog.Error("Loading location overrides failed", "path", defaultGazetteer.overridesPath, "err", err)
+		}
+	})
+	return defaultGazetteer
+}
+
+// defaultOverridesFile returns the override file used until SetOverridesFile is called
+func defaultOverridesFile() string {
+	return "geo_overrides.json"
+}
+
+// normalize makes "new_york-usa" and "New York Usa" the same key
+func normalize(location string) string {
+	return strings.ToLower(models.CleanLocationName(location))
+}
+
+// parseGazetteer reads "city,country,lat,lon" records
+func parseGazetteer(data string) (map[string]models.Coordinates, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 4
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]models.Coordinates, len(records))
+	for i, record := range records {
+		if i == 0 && record[0] == "city" {
+			continue // header
+		}
+		lat, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude %q", i+1, record[2])
+		}
+		lon, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude %q", i+1, record[3])
+		}
+		coords := models.Coordinates{Lat: lat, Lon: lon}
+		if err := validate(coords); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		entries[normalize(record[0]+" "+record[1])] = coords
+	}
+	return entries, nil
+}
+
+// validate checks that coordinates are within range
+func validate(c models.Coordinates) error {
+	if c.Lat < -90 || c.Lat > 90 {
+		return fmt.Errorf("latitude %v out of range", c.Lat)
+	}
+	if c.Lon < -180 || c.Lon > 180 {
+		return fmt.Errorf("longitude %v out of range", c.Lon)
+	}
+	return nil
+}
+
+// loadOverrides reads the override file. A missing file means no overrides.
+// The file maps location names to {"lat": ..., "lon": ...}.
+func (g *Gazetteer) loadOverrides() error {
+	g.mutex.RLock()
+	path := g.overridesPath
+	g.mutex.RUnlock()
+
+	overrides := make(map[string]models.Coordinates)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var raw map[string]models.Coordinates
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		for location, coords := range raw {
+			if err := validate(coords); err != nil {
+				return fmt.Errorf("%s: %v", location, err)
+			}
+			overrides[normalize(location)] = coords
+		}
+	}
+
+	g.mutex.Lock()
+	g.overrides = overrides
+	g.misses = make(map[string]bool)
+	g.mutex.Unlock()
+	return nil
+}
+
+// SetOverridesFile changes the override file and loads it immediately
+func SetOverridesFile(path string) error {
+	g := gazetteer()
+	g.mutex.Lock()
+	g.overridesPath = path
+	g.mutex.Unlock()
+	return g.loadOverrides()
+}
+
+// ReloadOverrides re-reads the override file
+func ReloadOverrides() error {
+	return gazetteer().loadOverrides()
+}
+
+// Lookup returns the coordinates of a location. Overrides win over the gazetteer.
+// Unknown locations are logged once so they can be added to the override file.
+func Lookup(location string) (models.Coordinates, bool) {
+	g := gazetteer()
+	key := normalize(location)
+
+	g.mutex.RLock()
+	coords, ok := g.overrides[key]
+	if !ok {
+		coords, ok = g.entries[key]
+	}
+	reported := g.misses[key]
+	g.mutex.RUnlock()
+
+	if !ok && !reported {
+		g.mutex.Lock()
+		g.misses[key] = true
+		g.mutex.Unlock()
+		slog.Warn("No coordinates for location, add it to the override file", "location", location)
+	}
+	return coords, ok
+}
+
+// Locate fills in the coordinates of each concert that can be resolved
+func Locate(concerts []models.Concert) {
+	for i := range concerts {
+		if coords, ok := Lookup(concerts[i].Location); ok {
+			c := coords
+			concerts[i].Coordinates = &c
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package geo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"groupie-tracker/internal/models"
+)
+
+func TestLookupGazetteer(t *testing.T) {
+	for _, location := range []string{"new_york-usa", "New York Usa", "playa_del_carmen-mexico", "penrose-new_zealand"} {
+		if _, ok := Lookup(location); !ok {
+			t.Errorf("Lookup(%q) found nothing", location)
+		}
+	}
+	if _, ok := Lookup("atlantis-ocean"); ok {
+		t.Error("Lookup(atlantis-ocean) should not resolve")
+	}
+}
+
+func TestLookupOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	data := `{"atlantis-ocean": {"lat": 10.5, "lon": -30}, "London Uk": {"lat": 1, "lon": 2}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOverridesFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetOverridesFile(defaultOverridesFile()) })
+
+	if coords, ok := Lookup("Atlantis Ocean"); !ok || coords.Lat != 10.5 || coords.Lon != -30 {
+		t.Errorf("Lookup(Atlantis Ocean) = %v, %v", coords, ok)
+	}
+	if coords, _ := Lookup("london-uk"); coords != (models.Coordinates{Lat: 1, Lon: 2}) {
+		t.Errorf("override should win over gazetteer, got %v", coords)
+	}
+}
+
+func TestSetOverridesFileRejectsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	if err := os.WriteFile(path, []byte(`{"x": {"lat": 91, "lon": 0}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOverridesFile(path); err == nil {
+		t.Error("expected an error for an out of range latitude")
+	}
+	SetOverridesFile(defaultOverridesFile())
+}
+
+func TestTourGeoJSON(t *testing.T) {
+	concerts := []models.Concert{
+		{Location: "London Uk", Date: "01-01-2020", Coordinates: &models.Coordinates{Lat: 51.5, Lon: -0.1}},
+		{Location: "Atlantis Ocean", Date: "02-01-2020"},
+		{Location: "Paris France", Date: "03-01-2020", Coordinates: &models.Coordinates{Lat: 48.9, Lon: 2.4}},
+	}
+
+	collection := TourGeoJSON(concerts)
+	if len(collection.Features) != 3 {
+		t.Fatalf("got %d features, want 2 points and a route", len(collection.Features))
+	}
+	if order := collection.Features[1].Properties["order"]; order != 3 {
+		t.Errorf("second point has order %v, want 3", order)
+	}
+	route := collection.Features[2].Geometry
+	if route.Type != "LineString" {
+		t.Fatalf("last feature is %s, want LineString", route.Type)
+	}
+	if first := route.Coordinates.([][]float64)[0]; first[0] != -0.1 || first[1] != 51.5 {
+		t.Errorf("route starts at %v, want [lon, lat] of London", first)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	london := models.Coordinates{Lat: 51.507, Lon: -0.128}
+	paris := models.Coordinates{Lat: 48.857, Lon: 2.352}
+	if d := Distance(london, paris); d < 340 || d > 345 {
+		t.Errorf("London to Paris = %.1f km, want about 343", d)
+	}
+	if d := Distance(paris, paris); d != 0 {
+		t.Errorf("distance to itself = %v, want 0", d)
+	}
+}
+
+func TestIndexNear(t *testing.T) {
+	at := func(lat, lon float64) *models.Coordinates { return &models.Coordinates{Lat: lat, Lon: lon} }
+	concerts := []models.Concert{
+		{ArtistID: 1, Location: "Paris France", Date: "01-01-2020", Coordinates: at(48.857, 2.352)},
+		{ArtistID: 2, Location: "London Uk", Date: "01-01-2020", Coordinates: at(51.507, -0.128)},
+		{ArtistID: 3, Location: "Tokyo Japan", Date: "01-01-2020", Coordinates: at(35.690, 139.692)},
+		{ArtistID: 4, Location: "Suva Fiji", Date: "01-01-2020", Coordinates: at(-18.1, 178.4)},
+		{ArtistID: 5, Location: "Apia Samoa", Date: "01-01-2020", Coordinates: at(-13.8, -171.8)},
+		{ArtistID: 6, Location: "Nowhere", Date: "01-01-2020"},
+	}
+	idx := NewIndex(concerts, 1)
+	if idx.Len() != 5 {
+		t.Errorf("Len() = %d, want 5 located concerts", idx.Len())
+	}
+
+	results := idx.Near(models.Coordinates{Lat: 50.85, Lon: 4.35}, 400) // Brussels
+	if len(results) != 2 || results[0].ArtistID != 1 || results[1].ArtistID != 2 {
+		t.Errorf("near Brussels = %v, want Paris then London", results)
+	}
+
+	// The search area wraps around the antimeridian
+	results = idx.Near(models.Coordinates{Lat: -16, Lon: 179.9}, 1500)
+	if len(results) != 2 || results[0].ArtistID != 4 || results[1].ArtistID != 5 {
+		t.Errorf("near the antimeridian = %v, want Suva then Apia", results)
+	}
+
+	if results := idx.Near(models.Coordinates{Lat: 0, Lon: 0}, 20037.5); len(results) != 5 {
+		t.Errorf("whole globe returned %d concerts, want 5", len(results))
+	}
+}
@@ -0,0 +1,60 @@
+package geo
+
+import "groupie-tracker/internal/models"
+
+// FeatureCollection is a GeoJSON (RFC 7946) feature collection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON Point or LineString. Positions are [lon, lat].
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// position converts coordinates to a GeoJSON position
+func position(c models.Coordinates) []float64 {
+	return []float64{c.Lon, c.Lat}
+}
+
+// TourGeoJSON turns chronologically sorted concerts into numbered Point
+// features and a LineString tracing the tour route.
+// Concerts without coordinates are skipped but keep their number.
+func TourGeoJSON(concerts []models.Concert) FeatureCollection {
+	collection := FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+	var route [][]float64
+
+	for i, concert := range concerts {
+		if concert.Coordinates == nil {
+			continue
+		}
+		collection.Features = append(collection.Features, Feature{
+			Type:     "Feature",
+			Geometry: Geometry{Type: "Point", Coordinates: position(*concert.Coordinates)},
+			Properties: map[string]interface{}{
+				"order":    i + 1,
+				"location": concert.Location,
+				"date":     concert.Date,
+			},
+		})
+		route = append(route, position(*concert.Coordinates))
+	}
+
+	if len(route) > 1 {
+		collection.Features = append(collection.Features, Feature{
+			Type:       "Feature",
+			Geometry:   Geometry{Type: "LineString", Coordinates: route},
+			Properties: map[string]interface{}{"route": true},
+		})
+	}
+	return collection
+}
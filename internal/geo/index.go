@@ -0,0 +1,129 @@
+package geo
+
+import (
+	"math"
+	"sort"
+
+	"groupie-tracker/internal/models"
+)
+
+// earthRadiusKm is the mean Earth radius used by Distance
+const earthRadiusKm = 6371.0
+
+// kmPerDegree is the length of one degree of latitude
+const kmPerDegree = math.Pi * earthRadiusKm / 180
+
+// Distance returns the great-circle distance between two points in kilometres (haversine)
+func Distance(a, b models.Coordinates) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Result is a concert found by a radius query
+type Result struct {
+	models.Concert
+	DistanceKm float64 `json:"distanceKm"`
+}
+
+// cell identifies one grid cell
+type cell struct {
+	row, col int
+}
+
+// Index is a uniform latitude/longitude grid over located concerts.
+// It is immutable once built, so it can be shared between goroutines.
+type Index struct {
+	cellSize float64 // degrees
+	cols     int
+	cells    map[cell][]int // cell -> positions in concerts
+	concerts []models.Concert
+}
+
+// NewIndex builds a grid index with the given cell size in degrees.
+// Concerts without coordinates are left out.
+func NewIndex(concerts []models.Concert, cellSize float64) *Index {
+	idx := &Index{
+		cellSize: cellSize,
+		cols:     int(math.Ceil(360 / cellSize)),
+		cells:    make(map[cell][]int),
+	}
+	for _, concert := range concerts {
+		if concert.Coordinates == nil {
+			continue
+		}
+		c := idx.cellOf(*concert.Coordinates)
+		idx.cells[c] = append(idx.cells[c], len(idx.concerts))
+		idx.concerts = append(idx.concerts, concert)
+	}
+	return idx
+}
+
+// Len returns the number of indexed concerts
+func (idx *Index) Len() int {
+	return len(idx.concerts)
+}
+
+func (idx *Index) cellOf(c models.Coordinates) cell {
+	return cell{
+		row: int(math.Floor((c.Lat + 90) / idx.cellSize)),
+		col: idx.wrapCol(int(math.Floor((c.Lon + 180) / idx.cellSize))),
+	}
+}
+
+func (idx *Index) wrapCol(col int) int {
+	return ((col % idx.cols) + idx.cols) % idx.cols
+}
+
+// Near returns the concerts within radiusKm of center, nearest first
+// (ties broken by date, then location)
+func (idx *Index) Near(center models.Coordinates, radiusKm float64) []Result {
+	latSpan := radiusKm / kmPerDegree
+	minLat, maxLat := center.Lat-latSpan, center.Lat+latSpan
+
+	// Close to a pole every longitude is within reach
+	var lonSpan float64
+	if minLat <= -89 || maxLat >= 89 {
+		lonSpan = 180
+	} else {
+		widest := math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180
+		lonSpan = math.Min(180, latSpan/math.Cos(widest))
+	}
+
+	top := idx.cellOf(models.Coordinates{Lat: math.Max(minLat, -90), Lon: center.Lon})
+	bottom := idx.cellOf(models.Coordinates{Lat: math.Min(maxLat, 90), Lon: center.Lon})
+	firstCol := int(math.Floor((center.Lon - lonSpan + 180) / idx.cellSize))
+	lastCol := int(math.Floor((center.Lon + lonSpan + 180) / idx.cellSize))
+	if lastCol-firstCol >= idx.cols {
+		firstCol, lastCol = 0, idx.cols-1
+	}
+
+	var results []Result
+	for row := top.row; row <= bottom.row; row++ {
+		for col := firstCol; col <= lastCol; col++ {
+			for _, i := range idx.cells[cell{row: row, col: idx.wrapCol(col)}] {
+				concert := idx.concerts[i]
+				distance := Distance(center, *concert.Coordinates)
+				if distance <= radiusKm {
+					results = append(results, Result{Concert: concert, DistanceKm: distance})
+				}
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].DistanceKm != results[j].DistanceKm {
+			return results[i].DistanceKm < results[j].DistanceKm
+		}
+		ti, tj := results[i].Time(), results[j].Time()
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return results[i].Location < results[j].Location
+	})
+	return results
+}
@@ -2,27 +2,87 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"groupie-tracker/internal/api"
+	"groupie-tracker/internal/changes"
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/export"
+	"groupie-tracker/internal/feeds"
+	"groupie-tracker/internal/geo"
+	"groupie-tracker/internal/ical"
+	"groupie-tracker/internal/metrics"
 	"groupie-tracker/internal/models"
+	templatefiles "groupie-tracker/internal/templates"
+	"groupie-tracker/internal/tour"
+	"groupie-tracker/internal/webhooks"
+	"groupie-tracker/static"
 )
 
-var templates *template.Template
+var (
+	templates       *template.Template
+	staticFiles     fs.FS = static.FS
+	suggestionLimit       = 5                       // Default number of location suggestions
+	siteURL               = "http://localhost:8080" // Root of absolute links, from the configuration
+)
 
-// Init loads the HTML templates
-func Init() {
-	var err error
-	templates, err = template.ParseGlob("internal/templates/*.html")
-	if err != nil {
-		log.Fatal("Failed to load templates:", err)
+// Assets are the templates and static files the handlers serve
+type Assets struct {
+	Source    string // "embedded" or the directories they are read from
+	Templates fs.FS
+	Static    fs.FS
+}
+
+// EmbeddedAssets returns the templates and static files built into the binary
+func EmbeddedAssets() Assets {
+	return Assets{Source: "embedded", Templates: templatefiles.FS, Static: static.FS}
+}
+
+// DiskAssets reads templates and static files from directories, so edits
+// show up without rebuilding
+func DiskAssets(templateDir, staticDir string) Assets {
+	return Assets{
+		Source:    templateDir + " and " + staticDir,
+		Templates: os.DirFS(templateDir),
+		Static:    os.DirFS(staticDir),
 	}
-	log.Println("Templates loaded successfully")
+}
+
+// Init loads the HTML templates and applies the configuration. In dev mode a
+// template error is shown on every page until it is fixed, instead of
+// stopping the server.
+func Init(cfg *config.Config, assets Assets) {
+	staticFiles = assets.Static
+	suggestionLimit = cfg.Search.SuggestionLimit
+	siteURL = cfg.Server.SiteURL()
+	adminCredentials = cfg.Admin
+	trustedProxies, _ = cfg.RateLimit.Proxies() // checked when the config was loaded
+	maxStaleness = cfg.Health.MaxStaleness
+	rateLimiters = map[string]*rateLimiter{
+		SearchGroup: newRateLimiter(cfg.RateLimit.SearchPerMinute, cfg.RateLimit.SearchBurst),
+		APIGroup:    newRateLimiter(cfg.RateLimit.APIPerMinute, cfg.RateLimit.APIBurst),
+	}
+	allowImagesFrom(cfg.Upstream.URL)
+
+	if err := loadTemplates(assets.Templates); err != nil {
+		if !cfg.Server.Dev {
+			slog.Error("Loading templates failed", "err", err)
+			os.Exit(1)
+		}
+		slog.Error("Loading templates failed, pages will show the error until it is fixed", "err", err)
+		return
+	}
+	slog.Info("Templates loaded", "source", assets.Source)
 }
 
 // HomeHandler shows the main page with all artists
@@ -32,64 +92,111 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	artists, err := api.FetchArtists()
+	artists, err := api.FetchArtists(r.Context())
 	if err != nil {
 		renderError(w, "Server Error", "Failed to load artists. Please try again later.", 500)
-		log.Println("Error fetching artists:", err)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
 		return
 	}
 
 	// Don't populate location data here - it's too slow for the main page
 	// Location data will be fetched on-demand for search
 
-	err = templates.ExecuteTemplate(w, "index.html", artists)
+	err = executeTemplate(w, "index.html", artists)
 	if err != nil {
 		renderError(w, "Server Error", "Error loading page. Please try again later.", 500)
-		log.Println("Template error:", err)
+		slog.ErrorContext(r.Context(), "Template error", "err", err)
 	}
 }
 
-// ArtistHandler shows details for a specific artist
+// ArtistHandler shows details for a specific artist at /artist/{ref}
 func ArtistHandler(w http.ResponseWriter, r *http.Request) {
-	// Get artist ID from URL
-	idStr := strings.TrimPrefix(r.URL.Path, "/artist/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		renderError(w, "Invalid Artist ID", "The artist ID you provided is not valid. Please try again.", 400)
-		return
+	if artist, ok := artistFromPath(w, r, ""); ok {
+		renderArtist(w, r, artist, false)
 	}
+}
 
-	// Get all artists and find the one we need
-	artists, err := api.FetchArtists()
+// ArtistConcertsHandler shows an artist's tour timeline and concert
+// schedule at /artist/{ref}/concerts
+func ArtistConcertsHandler(w http.ResponseWriter, r *http.Request) {
+	if artist, ok := artistFromPath(w, r, "/concerts"); ok {
+		renderArtist(w, r, artist, true)
+	}
+}
+
+// ArtistCalendarHandler serves an artist's concerts at /artist/{ref}/concerts.ics
+func ArtistCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if artist, ok := artistFromPath(w, r, "/concerts.ics"); ok {
+		artistCalendar(w, r, artist)
+	}
+}
+
+// TrailingSlashHandler redirects a path ending in a slash to the path without it
+func TrailingSlashHandler(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimSuffix(r.URL.EscapedPath(), "/")
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// artistFromPath finds the artist of an /artist/{ref} path, where ref is the
+// artist's slug or ID. Unless ref is the canonical slug it answers the
+// request itself, with a permanent redirect to the canonical path (the slug
+// followed by suffix) or a not found page, and returns false.
+func artistFromPath(w http.ResponseWriter, r *http.Request, suffix string) (models.Artist, bool) {
+	ref := r.PathValue("ref")
+	var (
+		artist models.Artist
+		found  bool
+		err    error
+	)
+	if id, isID := parseArtistID(ref); isID {
+		artist, found, err = api.ArtistByID(r.Context(), id)
+	} else {
+		artist, found, err = api.ArtistBySlug(r.Context(), strings.ToLower(ref))
+	}
 	if err != nil {
 		renderError(w, "Server Error", "Failed to load artists. Please try again later.", 500)
-		return
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
+		return artist, false
+	}
+	if !found {
+		renderError(w, "Artist Not Found", "The artist you're looking for doesn't exist. Please check the URL and try again.", 404)
+		return artist, false
 	}
 
-	var artist models.Artist
-	found := false
-	for _, a := range artists {
-		if a.ID == id {
-			artist = a
-			found = true
-			break
+	if ref != artist.Slug {
+		target := "/artist/" + url.PathEscape(artist.Slug) + suffix
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
 		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return artist, false
 	}
+	return artist, true
+}
 
-	if !found {
-		renderError(w, "Artist Not Found", "The artist you're looking for doesn't exist. Please check the URL and try again.", 404)
-		return
+// parseArtistID parses a path segment made only of digits as an artist ID
+func parseArtistID(ref string) (int, bool) {
+	if ref == "" || strings.Trim(ref, "0123456789") != "" {
+		return 0, false
 	}
+	id, err := strconv.Atoi(ref)
+	return id, err == nil
+}
 
+// renderArtist renders the artist page, or only its concerts
+func renderArtist(w http.ResponseWriter, r *http.Request, artist models.Artist, concertsOnly bool) {
 	// Get additional data
-	location, err := api.FetchLocation(artist.Locations)
+	location, err := api.FetchLocation(r.Context(), artist.Locations)
 	if err != nil {
-		log.Println("Error fetching location:", err)
+		slog.ErrorContext(r.Context(), "Error fetching location", "err", err)
 	}
 
-	relation, err := api.FetchRelation(artist.Relations)
+	relation, err := api.FetchRelation(r.Context(), artist.Relations)
 	if err != nil {
-		log.Println("Error fetching relation:", err)
+		slog.ErrorContext(r.Context(), "Error fetching relation", "err", err)
 	}
 
 	// Clean location names in relation data
@@ -97,39 +204,237 @@ func ArtistHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Prepare data for template
 	data := struct {
-		Artist   models.Artist
-		Location models.Location
-		Relation models.Relation
+		Artist       models.Artist
+		Location     models.Location
+		Relation     models.Relation
+		Timeline     tour.Timeline
+		ConcertsOnly bool
 	}{
-		Artist:   artist,
-		Location: location,
-		Relation: cleanedRelation,
+		Artist:       artist,
+		Location:     location,
+		Relation:     cleanedRelation,
+		Timeline:     tour.BuildTimeline(artist.ID, relation.Concerts(), tour.DefaultLegGapDays, time.Now()),
+		ConcertsOnly: concertsOnly,
 	}
 
-	err = templates.ExecuteTemplate(w, "artist.html", data)
+	err = executeTemplate(w, "artist.html", data)
 	if err != nil {
 		renderError(w, "Server Error", "Error loading artist page. Please try again later.", 500)
-		log.Println("Template error:", err)
+		slog.ErrorContext(r.Context(), "Template error", "err", err)
 	}
 }
 
-// populateLocationData fetches and populates location data for all artists
-func populateLocationData(artists []models.Artist) []models.Artist {
-	for i := range artists {
-		relation, err := api.FetchRelation(artists[i].Relations)
+// artistCalendar serves an artist's concerts as an iCalendar file
+func artistCalendar(w http.ResponseWriter, r *http.Request, artist models.Artist) {
+	relation, err := api.FetchRelation(r.Context(), artist.Relations)
+	if err != nil {
+		renderError(w, "Server Error", "Failed to load concerts. Please try again later.", 500)
+		slog.ErrorContext(r.Context(), "Error fetching relation", "err", err)
+		return
+	}
+
+	concerts := relation.Concerts()
+	geo.Locate(concerts)
+
+	cal := ical.Calendar{Name: artist.Name + " concerts"}
+	for _, concert := range concerts {
+		event, err := ical.ConcertEvent(artist, concert)
 		if err != nil {
-			log.Printf("Error fetching relation for artist %d: %v", artists[i].ID, err)
+			slog.WarnContext(r.Context(), "Skipping concert with invalid date", "artist", artist.ID, "date", concert.Date)
 			continue
 		}
+		cal.Events = append(cal.Events, event)
+	}
+
+	writeCalendar(w, r, cal, fmt.Sprintf("artist-%d-concerts.ics", artist.ID))
+}
+
+// ConcertsCalendarHandler serves all concerts as an iCalendar feed.
+// Optional filters: location (substring), from and to (yyyy-mm-dd, inclusive).
+func ConcertsCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	location := strings.ToLower(strings.TrimSpace(query.Get("location")))
 
-		// Extract location names from relation data
-		var locations []string
-		for location := range relation.DatesLocations {
-			locations = append(locations, models.CleanLocationName(location))
+	var from, to time.Time
+	var err error
+	if fromStr := query.Get("from"); fromStr != "" {
+		if from, err = time.Parse("2006-01-02", fromStr); err != nil {
+			renderError(w, "Invalid Date", "The 'from' date must look like 2024-01-31.", 400)
+			return
+		}
+	}
+	if toStr := query.Get("to"); toStr != "" {
+		if to, err = time.Parse("2006-01-02", toStr); err != nil {
+			renderError(w, "Invalid Date", "The 'to' date must look like 2024-01-31.", 400)
+			return
 		}
-		artists[i].LocationList = locations
 	}
-	return artists
+
+	artists, err := api.FetchArtists(r.Context())
+	if err != nil {
+		renderError(w, "Server Error", "Failed to load artists. Please try again later.", 500)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
+		return
+	}
+	relations, err := api.FetchRelations(r.Context())
+	if err != nil {
+		renderError(w, "Server Error", "Failed to load concerts. Please try again later.", 500)
+		slog.ErrorContext(r.Context(), "Error fetching relations", "err", err)
+		return
+	}
+
+	// Create a map for fast lookup
+	artistMap := make(map[int]models.Artist)
+	for _, artist := range artists {
+		artistMap[artist.ID] = artist
+	}
+
+	cal := ical.Calendar{Name: "Groupie Tracker concerts"}
+	for _, relation := range relations {
+		artist, exists := artistMap[relation.ID]
+		if !exists {
+			continue
+		}
+		concerts := relation.Concerts()
+		geo.Locate(concerts)
+		for _, concert := range concerts {
+			if location != "" && !strings.Contains(strings.ToLower(concert.Location), location) {
+				continue
+			}
+			event, err := ical.ConcertEvent(artist, concert)
+			if err != nil {
+				continue
+			}
+			if (!from.IsZero() && event.Date.Before(from)) || (!to.IsZero() && event.Date.After(to)) {
+				continue
+			}
+			cal.Events = append(cal.Events, event)
+		}
+	}
+
+	writeCalendar(w, r, cal, "concerts.ics")
+}
+
+// writeCalendar sends a calendar as a downloadable .ics file
+func writeCalendar(w http.ResponseWriter, r *http.Request, cal ical.Calendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if err := ical.Write(w, cal, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "Calendar write error", "err", err)
+	}
+}
+
+// ExportHandler streams the dataset as /export/{artists,concerts}.{csv,jsonl,xlsx}.
+// The optional q parameter filters artists the same way as the search page.
+// The column schema is sent in the X-Export-Columns header.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	filename := strings.TrimPrefix(r.URL.Path, "/export/")
+	dataset, format, _ := strings.Cut(filename, ".")
+	columns, known := export.Datasets[dataset]
+	contentType := export.ContentType(format)
+	if !known || contentType == "" {
+		renderError(w, "Page Not Found", "Exports are /export/artists or /export/concerts with .csv, .jsonl or .xlsx.", 404)
+		return
+	}
+
+	var artists []models.Artist
+	var err error
+	if query := r.URL.Query().Get("q"); query != "" {
+		artists, err = api.SearchArtists(r.Context(), query)
+	} else {
+		artists, err = api.FetchArtists(r.Context())
+	}
+	if err != nil {
+		renderError(w, "Server Error", "Failed to load artists. Please try again later.", 500)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
+		return
+	}
+	relations, err := api.FetchRelations(r.Context())
+	if err != nil {
+		renderError(w, "Server Error", "Failed to load concerts. Please try again later.", 500)
+		slog.ErrorContext(r.Context(), "Error fetching relations", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("X-Export-Columns", export.Schema(columns))
+	if err := export.Write(w, dataset, format, artists, relations); err != nil {
+		// Usually the client went away, the headers are already sent
+		slog.ErrorContext(r.Context(), "Export write error", "err", err)
+	}
+}
+
+// FeedArtistsAtomHandler serves newly added artists as an Atom feed
+func FeedArtistsAtomHandler(w http.ResponseWriter, r *http.Request) {
+	entries := feeds.Entries(feeds.KindArtistAdded)
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if err := feeds.WriteAtom(w, "Groupie Tracker: new artists", siteURL, "/feeds/artists.atom", entries); err != nil {
+		slog.ErrorContext(r.Context(), "Feed write error", "err", err)
+	}
+}
+
+// FeedConcertsRSSHandler serves added and removed concert dates as an RSS feed
+func FeedConcertsRSSHandler(w http.ResponseWriter, r *http.Request) {
+	entries := feeds.Entries(feeds.KindArtistAdded, feeds.KindDateAdded, feeds.KindDateRemoved)
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	if err := feeds.WriteRSS(w, "Groupie Tracker: concerts", siteURL, "New artists, new concert dates and removed dates.", entries); err != nil {
+		slog.ErrorContext(r.Context(), "Feed write error", "err", err)
+	}
+}
+
+// parseSince reads the optional "since" parameter as RFC 3339 or yyyy-mm-dd
+func parseSince(r *http.Request) (time.Time, error) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", since)
+}
+
+// APIChangesHandler returns the recorded upstream data changes, newest first
+func APIChangesHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r)
+	if err != nil {
+		apiError(w, "Query parameter 'since' must be a date (2024-01-31) or an RFC 3339 time", 400)
+		return
+	}
+
+	list := changes.Since(since)
+	if list == nil {
+		list = []changes.Change{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ChangesHandler shows the changelog of upstream data changes
+func ChangesHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r)
+	if err != nil {
+		renderError(w, "Invalid Date", "The 'since' date must look like 2024-01-31.", 400)
+		return
+	}
+
+	data := struct {
+		Since   time.Time
+		Changes []changes.Change
+	}{
+		Since:   since,
+		Changes: changes.Since(since),
+	}
+
+	err = executeTemplate(w, "changes.html", data)
+	if err != nil {
+		renderError(w, "Server Error", "Error loading changelog. Please try again later.", 500)
+		slog.ErrorContext(r.Context(), "Template error", "err", err)
+	}
 }
 
 // cleanRelationData cleans location names in relation data
@@ -149,6 +454,12 @@ func cleanRelationData(relation models.Relation) models.Relation {
 
 // renderError renders the error template with proper styling
 func renderError(w http.ResponseWriter, title, message string, statusCode int) {
+	tmpl, _ := currentTemplates()
+	if tmpl == nil {
+		http.Error(w, title+": "+message, statusCode)
+		return
+	}
+
 	// Set headers before writing status
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(statusCode)
@@ -156,12 +467,14 @@ func renderError(w http.ResponseWriter, title, message string, statusCode int) {
 	data := struct {
 		Title   string
 		Message string
+		Nonce   string
 	}{
 		Title:   title,
 		Message: message,
+		Nonce:   cspNonce(w),
 	}
 
-	err := templates.ExecuteTemplate(w, "error.html", data)
+	err := tmpl.ExecuteTemplate(w, "error.html", data)
 	if err != nil {
 		// Fallback to plain text if template fails
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -169,6 +482,13 @@ func renderError(w http.ResponseWriter, title, message string, statusCode int) {
 	}
 }
 
+// apiError writes an API error as JSON
+func apiError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
 // SearchHandler handles search requests
 func SearchHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
@@ -177,66 +497,55 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	artists, err := api.FetchArtists()
+	results, err := api.SearchArtists(r.Context(), query)
 	if err != nil {
 		renderError(w, "Server Error", "Failed to load artists. Please try again later.", 500)
 		return
 	}
 
-	// Only populate location data for search results, not all artists
-	// This is much faster than populating for all artists
-	searchQuery := strings.ToLower(query)
-	var results []models.Artist
-
-	// First pass: search without location data
-	for _, artist := range artists {
-		if strings.Contains(strings.ToLower(artist.Name), searchQuery) ||
-			strings.Contains(strings.ToLower(artist.FirstAlbum), searchQuery) ||
-			strings.Contains(strconv.Itoa(artist.CreationDate), searchQuery) ||
-			containsAny(artist.Members, searchQuery) {
-			results = append(results, artist)
-		}
-	}
-
-	// If no results found, try with location data (slower but more comprehensive)
-	if len(results) == 0 {
-		// Populate location data only for search
-		artistsWithLocations := populateLocationData(artists)
-		for _, artist := range artistsWithLocations {
-			if strings.Contains(artist.GetSearchableText(), searchQuery) {
-				results = append(results, artist)
-			}
-		}
-	}
-
-	err = templates.ExecuteTemplate(w, "index.html", results)
+	err = executeTemplate(w, "index.html", results)
 	if err != nil {
 		renderError(w, "Server Error", "Error loading search results. Please try again later.", 500)
-		log.Println("Template error:", err)
+		slog.ErrorContext(r.Context(), "Template error", "err", err)
 	}
 }
 
-// containsAny checks if any member contains the search query
-func containsAny(members []string, query string) bool {
-	for _, member := range members {
-		if strings.Contains(strings.ToLower(member), query) {
-			return true
-		}
-	}
-	return false
+// staticTypes are the file extensions served under /static/
+var staticTypes = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".svg":  true,
+	".ico":  true,
 }
 
-// StaticHandler serves static files
+// StaticHandler serves static files. Only whitelisted file types are served;
+// directories, traversal attempts and anything else are not found.
 func StaticHandler(w http.ResponseWriter, r *http.Request) {
-	http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))).ServeHTTP(w, r)
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if !fs.ValidPath(name) || !staticTypes[strings.ToLower(path.Ext(name))] {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := fs.Stat(staticFiles, name)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.StripPrefix("/static/", http.FileServer(http.FS(staticFiles))).ServeHTTP(w, r)
 }
 
 // APIArtistsHandler serves artists data as JSON for frontend
 func APIArtistsHandler(w http.ResponseWriter, r *http.Request) {
-	artists, err := api.FetchArtists()
+	artists, err := api.FetchArtists(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to load artists", 500)
-		log.Println("Error fetching artists:", err)
+		apiError(w, "Failed to load artists", 500)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
 		return
 	}
 
@@ -249,14 +558,94 @@ func APIArtistsHandler(w http.ResponseWriter, r *http.Request) {
 	// Convert to JSON and send
 	jsonData, err := json.Marshal(artists)
 	if err != nil {
-		http.Error(w, "Failed to encode artists data", 500)
-		log.Println("JSON encoding error:", err)
+		apiError(w, "Failed to encode artists data", 500)
+		slog.ErrorContext(r.Context(), "JSON encoding error", "err", err)
 		return
 	}
 
 	w.Write(jsonData)
 }
 
+// APIArtistResourceHandler serves per-artist data under /api/artists/{id}/
+func APIArtistResourceHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/artists/"), "/")
+	if len(parts) != 2 {
+		apiError(w, "Not found", 404)
+		return
+	}
+
+	// Only the canonical ID names an artist, not "+1" or "01"
+	id, isID := parseArtistID(parts[0])
+	if !isID || strconv.Itoa(id) != parts[0] {
+		apiError(w, "Artist not found", 404)
+		return
+	}
+
+	artist, found, err := api.ArtistByID(r.Context(), id)
+	if err != nil {
+		apiError(w, "Failed to load artists", 500)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
+		return
+	}
+	if !found {
+		apiError(w, "Artist not found", 404)
+		return
+	}
+
+	switch parts[1] {
+	case "concerts.geojson":
+		apiArtistConcertsGeoJSON(w, r, artist)
+	case "timeline":
+		apiArtistTimeline(w, r, artist)
+	default:
+		apiError(w, "Not found", 404)
+	}
+}
+
+// apiArtistConcertsGeoJSON serves an artist's concerts as GeoJSON for the tour map
+func apiArtistConcertsGeoJSON(w http.ResponseWriter, r *http.Request, artist models.Artist) {
+	relation, err := api.FetchRelation(r.Context(), artist.Relations)
+	if err != nil {
+		apiError(w, "Failed to load concerts", 500)
+		slog.ErrorContext(r.Context(), "Error fetching relation", "err", err)
+		return
+	}
+
+	concerts := relation.Concerts()
+	geo.Locate(concerts)
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Cache-Control", "public, max-age=300") // Cache for 5 minutes
+	json.NewEncoder(w).Encode(geo.TourGeoJSON(concerts))
+}
+
+// apiArtistTimeline serves an artist's concerts as a chronological timeline.
+// The optional "gap" parameter sets how many days without a concert start a new leg.
+func apiArtistTimeline(w http.ResponseWriter, r *http.Request, artist models.Artist) {
+	gap := tour.DefaultLegGapDays
+	if gapStr := r.URL.Query().Get("gap"); gapStr != "" {
+		g, err := strconv.Atoi(gapStr)
+		if err != nil || g < 1 {
+			apiError(w, "Query parameter 'gap' must be a positive number of days", 400)
+			return
+		}
+		gap = g
+	}
+
+	relation, err := api.FetchRelation(r.Context(), artist.Relations)
+	if err != nil {
+		apiError(w, "Failed to load concerts", 500)
+		slog.ErrorContext(r.Context(), "Error fetching relation", "err", err)
+		return
+	}
+
+	concerts := relation.Concerts()
+	geo.Locate(concerts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tour.BuildTimeline(artist.ID, concerts, gap, time.Now()))
+}
+
 // APICacheStatusHandler returns cache status information
 func APICacheStatusHandler(w http.ResponseWriter, r *http.Request) {
 	isCached, lastUpdate := api.GetCacheStatus()
@@ -273,19 +662,41 @@ func APICacheStatusHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+// MetricsHandler serves the metrics in the Prometheus text format
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.Default.Write(w); err != nil {
+		slog.ErrorContext(r.Context(), "Metrics write error", "err", err)
+	}
+}
+
+// AdminWebhookDeliveriesHandler lists recent webhook deliveries and the dead-letter log
+func AdminWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Deliveries  []webhooks.Delivery `json:"deliveries"`
+		DeadLetters []webhooks.Delivery `json:"deadLetters"`
+	}{
+		Deliveries:  webhooks.Deliveries(),
+		DeadLetters: webhooks.DeadLetters(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
 // APILocationSearchHandler handles location-based search
 func APILocationSearchHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "Query parameter 'q' is required", 400)
+		apiError(w, "Query parameter 'q' is required", 400)
 		return
 	}
 
 	// Use the optimized location search
-	matchingArtistIDs, err := api.SearchLocations(query)
+	matchingArtistIDs, err := api.SearchLocations(r.Context(), query)
 	if err != nil {
-		http.Error(w, "Failed to search locations", 500)
-		log.Println("Error searching locations:", err)
+		apiError(w, "Failed to search locations", 500)
+		slog.ErrorContext(r.Context(), "Error searching locations", "err", err)
 		return
 	}
 
@@ -296,10 +707,10 @@ func APILocationSearchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the matching artists
-	allArtists, err := api.FetchArtists()
+	allArtists, err := api.FetchArtists(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to load artists", 500)
-		log.Println("Error fetching artists:", err)
+		apiError(w, "Failed to load artists", 500)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
 		return
 	}
 
@@ -321,25 +732,116 @@ func APILocationSearchHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
+// APILocationsHandler returns every concert location with its artists and coordinates
+func APILocationsHandler(w http.ResponseWriter, r *http.Request) {
+	locations, err := api.FetchLocationIndex(r.Context())
+	if err != nil {
+		apiError(w, "Failed to load locations", 500)
+		slog.ErrorContext(r.Context(), "Error fetching locations", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300") // Cache for 5 minutes
+	json.NewEncoder(w).Encode(locations)
+}
+
+// maxRadiusKm is half the Earth's circumference, enough to cover the globe
+const maxRadiusKm = 20037.5
+
+// APIConcertsNearHandler returns concerts and artists within a radius, nearest first
+func APIConcertsNearHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, errLat := strconv.ParseFloat(query.Get("lat"), 64)
+	lon, errLon := strconv.ParseFloat(query.Get("lon"), 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		apiError(w, "Query parameters 'lat' and 'lon' must be valid coordinates", 400)
+		return
+	}
+
+	radiusKm := 100.0 // Default radius
+	if radiusStr := query.Get("radiusKm"); radiusStr != "" {
+		radius, err := strconv.ParseFloat(radiusStr, 64)
+		if err != nil || radius <= 0 || radius > maxRadiusKm {
+			apiError(w, "Query parameter 'radiusKm' must be between 0 and 20037.5", 400)
+			return
+		}
+		radiusKm = radius
+	}
+
+	concerts, err := api.ConcertsNear(r.Context(), models.Coordinates{Lat: lat, Lon: lon}, radiusKm)
+	if err != nil {
+		apiError(w, "Failed to search concerts", 500)
+		slog.ErrorContext(r.Context(), "Error searching concerts", "err", err)
+		return
+	}
+
+	allArtists, err := api.FetchArtists(r.Context())
+	if err != nil {
+		apiError(w, "Failed to load artists", 500)
+		slog.ErrorContext(r.Context(), "Error fetching artists", "err", err)
+		return
+	}
+
+	// Create a map for fast lookup
+	artistMap := make(map[int]models.Artist)
+	for _, artist := range allArtists {
+		artistMap[artist.ID] = artist
+	}
+
+	type nearbyArtist struct {
+		models.Artist
+		DistanceKm float64 `json:"distanceKm"`
+	}
+
+	// Concerts are sorted by distance, so the first one per artist is the nearest
+	artists := []nearbyArtist{}
+	seen := make(map[int]bool)
+	for _, concert := range concerts {
+		artist, exists := artistMap[concert.ArtistID]
+		if !exists || seen[artist.ID] {
+			continue
+		}
+		seen[artist.ID] = true
+		artists = append(artists, nearbyArtist{Artist: artist, DistanceKm: concert.DistanceKm})
+	}
+	if concerts == nil {
+		concerts = []geo.Result{}
+	}
+
+	response := struct {
+		RadiusKm float64        `json:"radiusKm"`
+		Concerts []geo.Result   `json:"concerts"`
+		Artists  []nearbyArtist `json:"artists"`
+	}{
+		RadiusKm: radiusKm,
+		Concerts: concerts,
+		Artists:  artists,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // APILocationSuggestionsHandler returns location suggestions for search
 func APILocationSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "Query parameter 'q' is required", 400)
+		apiError(w, "Query parameter 'q' is required", 400)
 		return
 	}
 
-	limit := 5 // Default limit
+	limit := suggestionLimit
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
 			limit = l
 		}
 	}
 
-	suggestions, err := api.GetLocationSuggestions(query, limit)
+	suggestions, err := api.GetLocationSuggestions(r.Context(), query, limit)
 	if err != nil {
-		http.Error(w, "Failed to get location suggestions", 500)
-		log.Println("Error getting location suggestions:", err)
+		apiError(w, "Failed to get location suggestions", 500)
+		slog.ErrorContext(r.Context(), "Error getting location suggestions", "err", err)
 		return
 	}
 
@@ -347,9 +849,66 @@ func APILocationSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(suggestions)
 }
 
-// APIClearCacheHandler clears the cache
-func APIClearCacheHandler(w http.ResponseWriter, r *http.Request) {
+// AdminCacheHandler reports the state of every cache
+func AdminCacheHandler(w http.ResponseWriter, r *http.Request) {
+	writeCacheState(w, "")
+}
+
+// AdminClearCacheHandler clears the cache
+func AdminClearCacheHandler(w http.ResponseWriter, r *http.Request) {
 	api.ClearCache()
+	writeCacheState(w, "Cache cleared successfully")
+}
+
+// AdminRefreshCacheHandler reloads every cache from upstream now
+func AdminRefreshCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if err := api.Refresh(r.Context()); err != nil {
+		apiError(w, "Failed to refresh the caches: "+err.Error(), http.StatusBadGateway)
+		slog.ErrorContext(r.Context(), "Error refreshing caches", "err", err)
+		return
+	}
+	writeCacheState(w, "Caches refreshed")
+}
+
+// AdminInvalidateCacheHandler empties the cache named in the path
+func AdminInvalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := api.Invalidate(name); err != nil {
+		apiError(w, "Unknown cache "+strconv.Quote(name), http.StatusNotFound)
+		return
+	}
+	writeCacheState(w, "Cache "+name+" invalidated")
+}
+
+// AdminInvalidateArtistHandler fetches one artist again from upstream,
+// leaving the rest of the caches as they are
+func AdminInvalidateArtistHandler(w http.ResponseWriter, r *http.Request) {
+	id, isID := parseArtistID(r.PathValue("id"))
+	if !isID {
+		apiError(w, "Invalid artist ID", http.StatusBadRequest)
+		return
+	}
+	found, err := api.RefreshArtist(r.Context(), id)
+	if err != nil {
+		apiError(w, "Failed to refresh the artist: "+err.Error(), http.StatusBadGateway)
+		slog.ErrorContext(r.Context(), "Error refreshing artist", "artist", id, "err", err)
+		return
+	}
+	if !found {
+		apiError(w, "Artist not found", http.StatusNotFound)
+		return
+	}
+	writeCacheState(w, fmt.Sprintf("Artist %d invalidated", id))
+}
+
+// writeCacheState answers an admin cache request with the state of the caches
+func writeCacheState(w http.ResponseWriter, message string) {
+	state := struct {
+		Message string            `json:"message,omitempty"`
+		Caches  []api.CacheStatus `json:"caches"`
+	}{message, api.CacheStatuses()}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Cache cleared successfully"})
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(state)
 }
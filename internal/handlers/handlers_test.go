@@ -1 +1,488 @@
 package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/api"
+	"groupie-tracker/internal/config"
+	"groupie-tracker/internal/logging"
+	templatefiles "groupie-tracker/internal/templates"
+)
+
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// render executes a template the way the page handlers do
+func render(name string) string {
+	rec := httptest.NewRecorder()
+	if err := executeTemplate(rec, name, "data"); err != nil {
+		return "error: " + err.Error()
+	}
+	return rec.Body.String()
+}
+
+func TestWatchTemplatesReloads(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "error.html", "{{.Title}}: {{.Message}}")
+	writeTemplate(t, dir, "index.html", "v1 {{.}}")
+	if err := loadTemplates(os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go WatchTemplates(10*time.Millisecond, stop)
+	time.Sleep(30 * time.Millisecond)
+
+	waitFor := func(want string) string {
+		t.Helper()
+		var got string
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if got = render("index.html"); strings.Contains(got, want) {
+				break
+			}
+		}
+		return got
+	}
+
+	writeTemplate(t, dir, "index.html", "v2 {{.}}")
+	if got := waitFor("v2"); got != "v2 data" {
+		t.Fatalf("after an edit the page is %q, want v2", got)
+	}
+
+	// A broken template is reported on the error page, not swapped in
+	writeTemplate(t, dir, "index.html", "v3 {{.")
+	if got := waitFor("Template Error"); !strings.Contains(got, "index.html") {
+		t.Fatalf("with a parse error the page is %q, want the error", got)
+	}
+
+	writeTemplate(t, dir, "index.html", "v4 {{.}}")
+	if got := waitFor("v4"); got != "v4 data" {
+		t.Fatalf("after fixing the error the page is %q, want v4", got)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	adminCredentials = config.AdminConfig{Token: "t0ken", Username: "admin", Password: "pa55"}
+	defer func() { adminCredentials = config.AdminConfig{} }()
+
+	handler := AdminHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+
+	for _, test := range []struct {
+		name string
+		auth func(r *http.Request)
+		want int
+	}{
+		{"no credentials", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ke") }, http.StatusUnauthorized},
+		{"token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("admin", "t0ken") }, http.StatusUnauthorized},
+		{"basic auth", func(r *http.Request) { r.SetBasicAuth("admin", "pa55") }, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/cache/clear", nil)
+		test.auth(req)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, rec.Code, test.want)
+		}
+		if rec.Code == http.StatusUnauthorized && len(rec.Header().Values("WWW-Authenticate")) != 2 {
+			t.Errorf("%s: missing WWW-Authenticate challenges", test.name)
+		}
+	}
+
+	// Without configured credentials nothing gets through, not even empty ones
+	adminCredentials = config.AdminConfig{}
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/clear", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unconfigured: status %d, want 401", rec.Code)
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "error.html", "{{.Title}}")
+	if err := loadTemplates(os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	router := NewRouter()
+	router.Page(http.MethodGet, "/artist/", ok)
+	router.API(http.MethodGet, "/api/items", ok)
+	router.API(http.MethodPost, "/api/items", ok)
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		allow        string
+		contentType  string
+	}{
+		{http.MethodGet, "/artist/1", 200, "", ""},
+		{http.MethodHead, "/artist/1", 200, "", ""},
+		{http.MethodPost, "/artist/1", 405, "GET, HEAD, OPTIONS", "text/html"},
+		{http.MethodOptions, "/artist/1", 204, "GET, HEAD, OPTIONS", ""},
+		{http.MethodPost, "/api/items", 200, "", ""},
+		{http.MethodDelete, "/api/items", 405, "GET, HEAD, POST, OPTIONS", "application/json"},
+		{http.MethodGet, "/api/nothing", 404, "", "application/json"},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+
+		if rec.Code != test.code {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.path, rec.Code, test.code)
+		}
+		if got := rec.Header().Get("Allow"); got != test.allow {
+			t.Errorf("%s %s: Allow = %q, want %q", test.method, test.path, got, test.allow)
+		}
+		if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, test.contentType) {
+			t.Errorf("%s %s: Content-Type = %q, want %q", test.method, test.path, got, test.contentType)
+		}
+	}
+}
+
+func TestArtistRoutes(t *testing.T) {
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artists":
+			fmt.Fprintf(w, `[{"id": 1, "name": "Queen"}, {"id": 2, "name": "AC/DC", "relations": "%s/relation/2"}, {"id": 3, "name": "Mötley Crüe"}]`, upstream.URL)
+		case "/relation/2":
+			w.Write([]byte(`{"id": 2, "datesLocations": {"london-uk": ["14-06-1986"]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	api.SetBaseURL(upstream.URL)
+	defer api.ClearCache()
+	if err := loadTemplates(templatefiles.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewRouter()
+	router.Page(http.MethodGet, "/artist/{ref}", ArtistHandler)
+	router.Page(http.MethodGet, "/artist/{ref}/{$}", TrailingSlashHandler)
+	router.Page(http.MethodGet, "/artist/{ref}/concerts", ArtistConcertsHandler)
+	router.API(http.MethodGet, "/api/artists/", APIArtistResourceHandler)
+
+	for _, test := range []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/artist/ac-dc", 200, ""},
+		{"/artist/ac-dc/concerts", 200, ""},
+		{"/artist/2", 301, "/artist/ac-dc"},
+		{"/artist/02", 301, "/artist/ac-dc"},
+		{"/artist/AC-DC", 301, "/artist/ac-dc"},
+		{"/artist/2/concerts?x=1", 301, "/artist/ac-dc/concerts?x=1"},
+		{"/artist/ac-dc/", 301, "/artist/ac-dc"},
+		{"/artist/m%C3%B6tley-cr%C3%BCe", 200, ""},
+		{"/artist/3", 301, "/artist/m%C3%B6tley-cr%C3%BCe"},
+		{"/artist/4", 404, ""},
+		{"/artist/-2", 404, ""},
+		{"/artist/ac-dc/members", 404, ""},
+		{"/api/artists/2/timeline", 200, ""},
+		{"/api/artists/02/timeline", 404, ""},
+		{"/api/artists/+2/timeline", 404, ""},
+		{"/api/artists/-2/timeline", 404, ""},
+		{"/api/artists/ac-dc/timeline", 404, ""},
+		{"/api/artists/4/timeline", 404, ""},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if rec.Code != test.code || rec.Header().Get("Location") != test.location {
+			t.Errorf("%s: %d to %q, want %d to %q", test.path, rec.Code, rec.Header().Get("Location"), test.code, test.location)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(60, 2) // one a second after a burst of two
+	start := time.Now()
+
+	for i, test := range []struct {
+		client string
+		after  time.Duration
+		ok     bool
+		wait   time.Duration
+	}{
+		{"a", 0, true, 0},
+		{"a", 0, true, 0},
+		{"a", 0, false, time.Second},
+		{"b", 0, true, 0}, // every client has its own bucket
+		{"a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		{"a", time.Second, true, 0},
+		{"a", time.Second, false, time.Second},
+	} {
+		ok, wait := limiter.take(test.client, start.Add(test.after))
+		if ok != test.ok || wait.Round(time.Millisecond) != test.wait {
+			t.Errorf("request %d: %v with wait %s, want %v with %s", i, ok, wait, test.ok, test.wait)
+		}
+	}
+
+	// Buckets that have filled up again are dropped
+	limiter.take("c", start.Add(90*time.Second))
+	if _, found := limiter.buckets["a"]; found || len(limiter.buckets) != 1 {
+		t.Errorf("after a minute idle the buckets are %v, want only c", limiter.buckets)
+	}
+}
+
+func TestRateLimitResponse(t *testing.T) {
+	rateLimiters = map[string]*rateLimiter{SearchGroup: newRateLimiter(60, 1)}
+	defer func() { rateLimiters = map[string]*rateLimiter{} }()
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	handler := RateLimit(SearchGroup, ok)
+	for i, want := range []int{200, 429} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/search/locations?q=x", nil))
+		if rec.Code != want {
+			t.Errorf("request %d: status %d, want %d", i, rec.Code, want)
+		}
+		if want == 429 && (rec.Header().Get("Retry-After") != "1" || !strings.Contains(rec.Body.String(), `"error"`)) {
+			t.Errorf("request %d: Retry-After %q and body %q, want 1 and a JSON error", i, rec.Header().Get("Retry-After"), rec.Body.String())
+		}
+	}
+
+	// Other groups are not limited
+	rec := httptest.NewRecorder()
+	RateLimit(APIGroup, ok)(rec, httptest.NewRequest(http.MethodGet, "/api/artists", nil))
+	if rec.Code == http.StatusTooManyRequests {
+		t.Error("a group without a limiter was limited")
+	}
+}
+
+func TestCallerIP(t *testing.T) {
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	defer func() { trustedProxies = nil }()
+
+	for _, test := range []struct {
+		remote, forwarded, want string
+	}{
+		{"203.0.113.5:1234", "", "203.0.113.5"},
+		{"203.0.113.5:1234", "198.51.100.1", "203.0.113.5"}, // not from a proxy, so not believed
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "192.0.2.9, 198.51.100.1, 10.0.0.2", "198.51.100.1"}, // the client can forge the start
+		{"10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1:1234", "garbage", "10.0.0.1"},
+		{"[::ffff:10.0.0.1]:1234", "198.51.100.1", "198.51.100.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := callerIP(r); got != test.want {
+			t.Errorf("%s via %q: got %s, want %s", test.remote, test.forwarded, got, test.want)
+		}
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var upstreamIDs []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamIDs = append(upstreamIDs, r.Header.Get("X-Request-ID"))
+		w.Write([]byte(`[{"id": 1, "name": "Queen"}]`))
+	}))
+	defer upstream.Close()
+	api.SetBaseURL(upstream.URL)
+	defer api.ClearCache()
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	if err := logging.Setup(&logs, "json", "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewRouter()
+	router.API(http.MethodGet, "/api/artists", APIArtistsHandler)
+	handler := LogRequests(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/artists", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("X-Request-ID = %q, want the client's", got)
+	}
+	if len(upstreamIDs) != 1 || upstreamIDs[0] != "abc-123" {
+		t.Errorf("upstream got request IDs %q, want abc-123", upstreamIDs)
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || records[0]["msg"] != "Upstream request" || records[0]["request_id"] != "abc-123" {
+		t.Fatalf("logs = %v, want the upstream call then the request, both with the ID", records)
+	}
+	request := records[1]
+	if request["request_id"] != "abc-123" || request["route"] != "/api/artists" || request["status"] != float64(200) ||
+		request["method"] != "GET" || request["client"] != "192.0.2.1" || request["bytes"].(float64) == 0 {
+		t.Errorf("request log = %v", request)
+	}
+
+	rec = httptest.NewRecorder()
+	MetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`groupie_http_requests_total{route="/api/artists",status="200"} `,
+		`groupie_http_request_duration_seconds_count{route="/api/artists",status="200"} `,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+
+	// Unusable IDs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/nowhere", nil)
+	req.Header.Set("X-Request-ID", "two words")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); !logging.ValidRequestID(got) || got == "two words" {
+		t.Errorf("X-Request-ID = %q, want a new ID", got)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artists":
+			w.Write([]byte(`[{"id": 1, "name": "Queen"}]`))
+		case "/relation":
+			w.Write([]byte(`{"index": [{"id": 1, "datesLocations": {"london-uk": ["14-06-1986"]}}]}`))
+		}
+	}))
+	defer upstream.Close()
+	api.SetBaseURL(upstream.URL)
+	defer api.ClearCache()
+	if err := loadTemplates(templatefiles.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	readyz := func() (int, map[string]bool) {
+		rec := httptest.NewRecorder()
+		ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body struct {
+			Checks []healthCheck `json:"checks"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		ok := make(map[string]bool)
+		for _, check := range body.Checks {
+			ok[check.Name] = check.OK
+		}
+		return rec.Code, ok
+	}
+
+	if code, ok := readyz(); code != 503 || ok["dataset"] || !ok["templates"] || !ok["upstream"] {
+		t.Errorf("before loading: %d %v, want 503 with only the dataset failing", code, ok)
+	}
+	if err := api.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code, ok := readyz(); code != 200 {
+		t.Errorf("after loading: %d %v, want 200", code, ok)
+	}
+
+	defer func(previous time.Duration) { maxStaleness = previous }(maxStaleness)
+	maxStaleness = time.Nanosecond
+	if code, ok := readyz(); code != 503 || ok["dataset"] {
+		t.Errorf("with stale data: %d %v, want 503", code, ok)
+	}
+}
+
+func TestAdminCacheRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artists":
+			w.Write([]byte(`[{"id": 1, "name": "Queen"}]`))
+		case "/artists/1":
+			w.Write([]byte(`{"id": 1, "name": "Queen"}`))
+		case "/relation":
+			w.Write([]byte(`{"index": [{"id": 1, "datesLocations": {"london-uk": ["14-06-1986"]}}]}`))
+		default:
+			w.Write([]byte(`{"id": 0}`))
+		}
+	}))
+	defer upstream.Close()
+	api.SetBaseURL(upstream.URL)
+	defer api.ClearCache()
+
+	router := NewRouter()
+	router.API(http.MethodGet, "/admin/cache", AdminCacheHandler)
+	router.API(http.MethodPost, "/admin/cache/refresh", AdminRefreshCacheHandler)
+	router.API(http.MethodPost, "/admin/cache/{name}/invalidate", AdminInvalidateCacheHandler)
+	router.API(http.MethodPost, "/admin/cache/artists/{id}/invalidate", AdminInvalidateArtistHandler)
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		loaded       string // the caches loaded afterwards
+	}{
+		{http.MethodGet, "/admin/cache", 200, ""},
+		{http.MethodPost, "/admin/cache/refresh", 200, "artists locations"},
+		{http.MethodPost, "/admin/cache/locations/invalidate", 200, "artists"},
+		{http.MethodPost, "/admin/cache/artists/1/invalidate", 200, "artists"},
+		{http.MethodPost, "/admin/cache/artists/7/invalidate", 404, ""},
+		{http.MethodPost, "/admin/cache/artists/x/invalidate", 400, ""},
+		{http.MethodPost, "/admin/cache/dates/invalidate", 404, ""},
+		{http.MethodPost, "/admin/cache/artists/invalidate", 200, ""},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+		if rec.Code != test.code {
+			t.Errorf("%s %s: status %d, want %d: %s", test.method, test.path, rec.Code, test.code, rec.Body)
+			continue
+		}
+		if rec.Code != 200 {
+			continue
+		}
+
+		var state struct {
+			Caches []api.CacheStatus `json:"caches"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+			t.Fatal(err)
+		}
+		var loaded []string
+		for _, cache := range state.Caches {
+			if cache.Loaded {
+				loaded = append(loaded, cache.Name)
+			}
+		}
+		if len(state.Caches) != 2 || strings.Join(loaded, " ") != test.loaded {
+			t.Errorf("%s %s: loaded caches %v of %d, want %q", test.method, test.path, loaded, len(state.Caches), test.loaded)
+		}
+	}
+}
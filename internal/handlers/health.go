@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"groupie-tracker/internal/api"
+)
+
+// maxStaleness is the age of the upstream data after which the server is
+// no longer ready
+var maxStaleness = 15 * time.Minute
+
+// startTime is when the process started, for the liveness uptime
+var startTime = time.Now()
+
+// healthCheck is the result of one readiness check
+type healthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// HealthzHandler answers the liveness probe: the process is up and serving
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, struct {
+		Status string `json:"status"`
+		Uptime string `json:"uptime"`
+	}{"ok", time.Since(startTime).Round(time.Second).String()})
+}
+
+// ReadyzHandler answers the readiness probe: the server can render artist
+// pages. It is ready when the templates are loaded, the dataset is loaded
+// and recent enough, and the upstream breaker is not open. Otherwise it
+// answers 503 Service Unavailable, with the failing checks.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	checks := []healthCheck{templatesCheck(), datasetCheck(now), upstreamCheck()}
+
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, code, struct {
+		Status string        `json:"status"`
+		Checks []healthCheck `json:"checks"`
+	}{status, checks})
+}
+
+func templatesCheck() healthCheck {
+	tmpl, err := currentTemplates()
+	switch {
+	case err != nil:
+		return healthCheck{"templates", false, "parse error: " + err.Error()}
+	case tmpl == nil:
+		return healthCheck{"templates", false, "not loaded"}
+	}
+	return healthCheck{"templates", true, fmt.Sprintf("%d templates loaded", len(tmpl.Templates()))}
+}
+
+func datasetCheck(now time.Time) healthCheck {
+	artists, relations := api.DatasetUpdated()
+	if artists.IsZero() || relations.IsZero() {
+		return healthCheck{"dataset", false, "artists or relations not loaded yet"}
+	}
+	oldest := artists
+	if relations.Before(oldest) {
+		oldest = relations
+	}
+	age := now.Sub(oldest)
+	if age > maxStaleness {
+		return healthCheck{"dataset", false, fmt.Sprintf("last fetched %s ago, more than the %s allowed", age.Round(time.Second), maxStaleness)}
+	}
+	return healthCheck{"dataset", true, fmt.Sprintf("last fetched %s ago", age.Round(time.Second))}
+}
+
+func upstreamCheck() healthCheck {
+	breaker := api.UpstreamBreaker()
+	switch breaker.State {
+	case api.BreakerOpen:
+		return healthCheck{"upstream", false, fmt.Sprintf("breaker open since %s after %d failures in a row",
+			breaker.OpenedAt.Format(time.RFC3339), breaker.Failures)}
+	case api.BreakerHalfOpen:
+		return healthCheck{"upstream", true, "breaker half-open, the next upstream call is a retry"}
+	}
+	return healthCheck{"upstream", true, fmt.Sprintf("breaker closed, %d failures in a row", breaker.Failures)}
+}
+
+// writeHealth writes a health response, which must never be cached
+func writeHealth(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
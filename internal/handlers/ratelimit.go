@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit groups. Each client has a separate budget for each group.
+const (
+	SearchGroup = "search" // full scans of the artists and locations
+	APIGroup    = "api"    // the other API endpoints
+)
+
+// rateLimiters are the limiters by group; a group without one is not limited
+var rateLimiters = map[string]*rateLimiter{}
+
+// trustedProxies are the proxies whose X-Forwarded-For header is believed
+var trustedProxies []netip.Prefix
+
+// RateLimit limits how often each client may call a handler. Clients over
+// their group's budget get 429 Too Many Requests with a Retry-After header.
+func RateLimit(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := rateLimiters[group]
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+
+		ok, wait := limiter.take(callerIP(r), time.Now())
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				apiError(w, "Too many requests, try again in "+strconv.Itoa(seconds)+"s", http.StatusTooManyRequests)
+				return
+			}
+			renderError(w, "Too Many Requests", "You're searching too fast. Please wait a few seconds and try again.", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimiter keeps a token bucket per client. A bucket holds at most burst
+// tokens, refills at rate tokens a second and each request takes one.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter returns a limiter for perMinute requests a minute after an
+// initial burst, or nil when perMinute is 0
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// take spends one of the client's tokens. Without one left it returns how
+// long until the next one.
+func (l *rateLimiter) take(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, found := l.buckets[client]
+	if !found {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill returns the tokens a bucket has at now
+func (l *rateLimiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+}
+
+// sweep forgets the buckets that have filled up again, since they are the
+// same as new ones. It runs at most once per refill time, so the map only
+// holds the clients seen recently.
+func (l *rateLimiter) sweep(now time.Time) {
+	fullAfter := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < max(fullAfter, time.Minute) {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// callerIP returns the address of the client. Behind trusted proxies it is
+// the last address in X-Forwarded-For that is not itself a trusted proxy.
+func callerIP(r *http.Request) string {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	client := addr.Addr().Unmap()
+	if !trustedProxy(client) {
+		return client.String()
+	}
+
+	// Proxies append the address they got the request from, so walk back
+	// from the end until an address we can't vouch for
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !trustedProxy(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// trustedProxy reports whether addr belongs to a trusted proxy
+func trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"groupie-tracker/internal/logging"
+	"groupie-tracker/internal/metrics"
+)
+
+// Request metrics, by route pattern rather than path so unknown paths
+// can't add series
+var (
+	requestsTotal = metrics.NewCounter("groupie_http_requests_total",
+		"Requests answered, by route and status code.", "route", "status")
+	requestDuration = metrics.NewHistogram("groupie_http_request_duration_seconds",
+		"Time taken to answer requests, by route and status code.", metrics.DefaultBuckets, "route", "status")
+)
+
+// LogRequests logs every request once it has been answered and counts it
+// in the request metrics. Each request gets an ID, from a valid
+// X-Request-ID header or a new one, which is sent back in X-Request-ID and
+// added to every log line the request causes.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(logging.WithRequestID(r.Context(), id))
+
+		rec := &responseRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK // nothing written
+		}
+
+		duration := time.Since(start)
+		pattern, status := route(r), strconv.Itoa(rec.status)
+		requestsTotal.Inc(pattern, status)
+		requestDuration.Observe(duration.Seconds(), pattern, status)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "Request",
+			"method", r.Method,
+			"route", pattern,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", duration,
+			"client", callerIP(r),
+		)
+	})
+}
+
+// route returns the path pattern that matched the request without its
+// method, like /artist/{ref}. Unknown paths match /.
+func route(r *http.Request) string {
+	if method, path, found := strings.Cut(r.Pattern, " "); found && !strings.HasPrefix(method, "/") {
+		return path
+	}
+	return r.Pattern
+}
+
+// responseRecorder remembers the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap gives http.ResponseController the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ErrorFormat is how a route reports errors
+type ErrorFormat int
+
+const (
+	HTMLErrors ErrorFormat = iota // the error page, for pages and downloads
+	JSONErrors                    // {"error": "..."}, for the API
+)
+
+// Router registers handlers for the methods they accept. HEAD is served by
+// the GET handler, OPTIONS lists the allowed methods and any other method
+// gets 405 Method Not Allowed with an Allow header. Errors use the format of
+// the route.
+type Router struct {
+	mux     *http.ServeMux
+	allowed map[string][]string // methods by path pattern
+}
+
+// NewRouter creates a router whose unknown paths are not found, as JSON
+// under /api/ and /admin/ and as the error page elsewhere
+func NewRouter() *Router {
+	rt := &Router{mux: http.NewServeMux(), allowed: make(map[string][]string)}
+	rt.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/admin/") {
+			apiError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		renderError(w, "Page Not Found", "The page you're looking for doesn't exist.", http.StatusNotFound)
+	})
+	return rt
+}
+
+// Page registers a handler for a method and path pattern whose errors are
+// HTML, like "GET /artist/"
+func (rt *Router) Page(method, path string, handler http.HandlerFunc) {
+	rt.handle(method, path, HTMLErrors, handler)
+}
+
+// API registers a handler for a method and path pattern whose errors are JSON
+func (rt *Router) API(method, path string, handler http.HandlerFunc) {
+	rt.handle(method, path, JSONErrors, handler)
+}
+
+func (rt *Router) handle(method, path string, format ErrorFormat, handler http.HandlerFunc) {
+	if _, registered := rt.allowed[path]; !registered {
+		// Requests for the path that no method pattern matches end up here
+		rt.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			rt.otherMethod(w, r, path, format)
+		})
+	}
+	rt.allowed[path] = append(rt.allowed[path], method)
+	rt.mux.HandleFunc(method+" "+path, handler)
+}
+
+// otherMethod answers OPTIONS and refuses methods the path does not accept
+func (rt *Router) otherMethod(w http.ResponseWriter, r *http.Request, path string, format ErrorFormat) {
+	w.Header().Set("Allow", rt.allow(path))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if format == JSONErrors {
+		apiError(w, "Method "+r.Method+" not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderError(w, "Method Not Allowed", "This page can't be used with a "+r.Method+" request.", http.StatusMethodNotAllowed)
+}
+
+// allow returns the Allow header for a path pattern
+func (rt *Router) allow(path string) string {
+	var methods []string
+	for _, method := range rt.allowed[path] {
+		methods = append(methods, method)
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	return strings.Join(append(methods, http.MethodOptions), ", ")
+}
+
+// ServeHTTP dispatches the request to its route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	templateMutex sync.RWMutex
+	templateFiles fs.FS
+	templateErr   error // last parse error, shown instead of pages until fixed
+)
+
+// loadTemplates parses the templates in fsys and swaps them in. On a parse
+// error the previous templates stay in place and the error is remembered so
+// pages can report it.
+func loadTemplates(fsys fs.FS) error {
+	parsed, err := template.ParseFS(fsys, "*.html")
+
+	templateMutex.Lock()
+	defer templateMutex.Unlock()
+	templateFiles = fsys
+	templateErr = err
+	if err == nil {
+		templates = parsed
+	}
+	return err
+}
+
+// currentTemplates returns the template set and the last parse error
+func currentTemplates() (*template.Template, error) {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	return templates, templateErr
+}
+
+// executeTemplate renders a page. While the templates fail to parse it
+// renders the parse error on the error page instead and returns nil, since
+// the response has been written.
+func executeTemplate(w http.ResponseWriter, name string, data interface{}) error {
+	tmpl, parseErr := currentTemplates()
+	if parseErr != nil {
+		renderError(w, "Template Error", parseErr.Error(), 500)
+		return nil
+	}
+	if tmpl == nil {
+		return errors.New("templates are not loaded")
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+// WatchTemplates checks the templates every interval and reloads them when
+// one is added, removed or modified, until stop is closed. It is meant for
+// dev mode; otherwise the templates are parsed once by Init.
+func WatchTemplates(interval time.Duration, stop <-chan struct{}) {
+	templateMutex.RLock()
+	fsys := templateFiles
+	templateMutex.RUnlock()
+
+	last := templateVersion(fsys)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		version := templateVersion(fsys)
+		if version == last {
+			continue
+		}
+		last = version
+		if err := loadTemplates(fsys); err != nil {
+			slog.Error("Reloading templates failed", "err", err)
+		} else {
+			slog.Info("Templates reloaded")
+		}
+	}
+}
+
+// templateVersion summarizes the names, sizes and modification times of the
+// templates, so any edit changes it
+func templateVersion(fsys fs.FS) string {
+	names, _ := fs.Glob(fsys, "*.html")
+	var b strings.Builder
+	for _, name := range names {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
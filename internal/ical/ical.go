@@ -0,0 +1,128 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"groupie-tracker/internal/models"
+)
+
+// maxLineOctets is the longest content line allowed by RFC 5545 (without CRLF)
+const maxLineOctets = 75
+
+const (
+	dateLayout  = "20060102"
+	stampLayout = "20060102T150405Z"
+)
+
+// Event is an all-day calendar event
+type Event struct {
+	UID         string
+	Summary     string
+	Location    string
+	Description string
+	Date        time.Time
+	Coordinates *models.Coordinates
+}
+
+// Calendar is a named list of events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// ConcertUID returns a stable UID for a concert, so re-importing a feed
+// updates events instead of duplicating them
+func ConcertUID(artistID int, location string, date time.Time) string {
+	return fmt.Sprintf("%d-%s-%s@groupie-tracker", artistID, models.Slug(location), date.Format(dateLayout))
+}
+
+// ConcertEvent turns a concert of an artist into a calendar event
+func ConcertEvent(artist models.Artist, concert models.Concert) (Event, error) {
+	date, err := models.ParseConcertDate(concert.Date)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		UID:         ConcertUID(artist.ID, concert.Location, date),
+		Summary:     artist.Name + " in " + concert.Location,
+		Location:    concert.Location,
+		Description: artist.Name + " live in " + concert.Location + " (" + strings.Join(artist.Members, ", ") + ")",
+		Date:        date,
+		Coordinates: concert.Coordinates,
+	}, nil
+}
+
+// Write encodes the calendar as RFC 5545 text. stamp is used as DTSTAMP.
+func Write(w io.Writer, cal Calendar, stamp time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Groupie Tracker//Concerts//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escape(cal.Name))
+	}
+
+	for _, event := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(event.UID))
+		line("DTSTAMP", stamp.UTC().Format(stampLayout))
+		line("DTSTART;VALUE=DATE", event.Date.Format(dateLayout))
+		line("DTEND;VALUE=DATE", event.Date.AddDate(0, 0, 1).Format(dateLayout))
+		line("SUMMARY", escape(event.Summary))
+		if event.Location != "" {
+			line("LOCATION", escape(event.Location))
+		}
+		if event.Coordinates != nil {
+			line("GEO", fmt.Sprintf("%.6f;%.6f", event.Coordinates.Lat, event.Coordinates.Lon))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// escape escapes TEXT values (RFC 5545 section 3.3.11)
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writeFolded writes a content line, folding it into 75 octet pieces without
+// splitting UTF-8 sequences. Continuation lines start with a space.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // the leading space counts
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,127 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// property is one parsed content line
+type property struct {
+	name, params, value string
+}
+
+// parse unfolds and splits RFC 5545 text into components of properties
+func parse(t *testing.T, data string) [][]property {
+	t.Helper()
+
+	if !strings.HasSuffix(data, "\r\n") {
+		t.Fatal("output does not end with CRLF")
+	}
+	unfolded := strings.ReplaceAll(data, "\r\n ", "")
+	var events [][]property
+	var current []property
+	for _, line := range strings.Split(strings.TrimSuffix(unfolded, "\r\n"), "\r\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			t.Fatalf("line without colon: %q", line)
+		}
+		name, value := line[:colon], line[colon+1:]
+		params := ""
+		if semi := strings.Index(name, ";"); semi >= 0 {
+			name, params = name[:semi], name[semi+1:]
+		}
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = []property{}
+		case name == "END" && value == "VEVENT":
+			events = append(events, current)
+			current = nil
+		case current != nil:
+			current = append(current, property{name, params, unescape(value)})
+		}
+	}
+	return events
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+func get(props []property, name string) property {
+	for _, p := range props {
+		if p.name == name {
+			return p
+		}
+	}
+	return property{}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	artist := models.Artist{ID: 12, Name: "AC/DC; \"Live\", Again", Members: []string{"Angus Young", "Malcolm Young"}}
+	concert := models.Concert{
+		Location:    "Playa Del Carmen Mexico",
+		Date:        "*05-12-2019",
+		Coordinates: &models.Coordinates{Lat: 20.629, Lon: -87.074},
+	}
+	event, err := ConcertEvent(artist, concert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Description = strings.Repeat("Très long déscription ", 10) + "\nsecond line"
+
+	var buf bytes.Buffer
+	stamp := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	if err := Write(&buf, Calendar{Name: "Concerts", Events: []Event{event}}, stamp); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("bare newline in %q", line)
+		}
+	}
+
+	events := parse(t, buf.String())
+	if len(events) != 1 {
+		t.Fatalf("parsed %d events, want 1", len(events))
+	}
+	props := events[0]
+
+	if got := get(props, "UID").value; got != "12-playa-del-carmen-mexico-20191205@groupie-tracker" {
+		t.Errorf("UID = %q", got)
+	}
+	if got := get(props, "DTSTART"); got.params != "VALUE=DATE" || got.value != "20191205" {
+		t.Errorf("DTSTART = %+v", got)
+	}
+	if got := get(props, "DTEND").value; got != "20191206" {
+		t.Errorf("DTEND = %q, want the day after", got)
+	}
+	if got := get(props, "DTSTAMP").value; got != "20240301T123000Z" {
+		t.Errorf("DTSTAMP = %q", got)
+	}
+	if got := get(props, "SUMMARY").value; got != event.Summary {
+		t.Errorf("SUMMARY = %q, want %q", got, event.Summary)
+	}
+	if got := get(props, "DESCRIPTION").value; got != event.Description {
+		t.Errorf("DESCRIPTION did not round-trip:\n got %q\nwant %q", got, event.Description)
+	}
+	if got := get(props, "GEO").value; got != "20.629000;-87.074000" {
+		t.Errorf("GEO = %q", got)
+	}
+}
+
+func TestConcertUIDIsStable(t *testing.T) {
+	date := time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)
+	a := ConcertUID(3, "New York Usa", date)
+	b := ConcertUID(3, "new york  usa", date)
+	if a != b || a != "3-new-york-usa-20200105@groupie-tracker" {
+		t.Errorf("ConcertUID = %q and %q, want the same stable UID", a, b)
+	}
+}
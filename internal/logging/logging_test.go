@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, "json", "info"); err != nil {
+		t.Fatal(err)
+	}
+	slog.DebugContext(context.Background(), "hidden")
+	slog.InfoContext(WithRequestID(context.Background(), "req-1"), "fetched", "url", "/artists")
+	log.Println("from the log package")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "fetched" || record["request_id"] != "req-1" || record["url"] != "/artists" {
+		t.Errorf("first line = %v, want the request ID and attributes", record)
+	}
+	if !strings.Contains(lines[1], `"msg":"from the log package"`) {
+		t.Errorf("second line = %s, want the log package message", lines[1])
+	}
+
+	for _, bad := range [][2]string{{"xml", "info"}, {"text", "loud"}} {
+		if err := Setup(&buf, bad[0], bad[1]); err == nil {
+			t.Errorf("Setup(%q, %q) accepted", bad[0], bad[1])
+		}
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"abc-123_x.y":           true,
+		NewRequestID():          true,
+		"":                      false,
+		"has space":             false,
+		"line\nbreak":           false,
+		strings.Repeat("a", 65): false,
+	} {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
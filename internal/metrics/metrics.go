@@ -0,0 +1,314 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of the latency histograms, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry served on /metrics
+var Default = NewRegistry()
+
+// metric is a named family of series
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and writes them out
+type Registry struct {
+	mu        sync.Mutex
+	metrics   map[string]metric
+	collected []func() // run before every write to update gauges
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, taken := r.metrics[m.name()]; taken {
+		panic("metrics: " + m.name() + " registered twice")
+	}
+	r.metrics[m.name()] = m
+}
+
+// OnCollect runs collect before every write, for gauges that are cheaper
+// to update together than one by one
+func (r *Registry) OnCollect(collect func()) {
+	r.mu.Lock()
+	r.collected = append(r.collected, collect)
+	r.mu.Unlock()
+}
+
+// Write writes every metric in the text exposition format, sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collected := append([]func(){}, r.collected...)
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+
+	for _, collect := range collected {
+		collect()
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// family is the name, help and label names shared by the series of a metric
+type family struct {
+	metricName string
+	help       string
+	kind       string // counter, gauge or histogram
+	labels     []string
+}
+
+func (f *family) name() string { return f.metricName }
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(f.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, help, f.metricName, f.kind)
+}
+
+// labelPairs formats label names and values as {a="1",b="2"}, with extra
+// pairs after them
+func labelPairs(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escape.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escape.Replace(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// seriesKey identifies the series of a set of label values
+func seriesKey(f *family, values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// sortedKeys returns the keys of a series map in order, for stable output
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// value is one series of a counter or gauge
+type value struct {
+	labels []string
+	v      float64
+}
+
+// vector holds the series of a counter or gauge
+type vector struct {
+	family
+	mu     sync.Mutex
+	series map[string]*value
+}
+
+func (vec *vector) update(values []string, f func(v float64) float64) {
+	key := seriesKey(&vec.family, values)
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	s, found := vec.series[key]
+	if !found {
+		s = &value{labels: append([]string(nil), values...)}
+		vec.series[key] = s
+	}
+	s.v = f(s.v)
+}
+
+func (vec *vector) write(w *bufio.Writer) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	vec.writeHeader(w)
+	for _, key := range sortedKeys(vec.series) {
+		s := vec.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", vec.metricName, labelPairs(vec.labels, s.labels), formatValue(s.v))
+	}
+}
+
+// Counter is a value that only goes up, per combination of label values
+type Counter struct{ vector }
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vector{family: family{name, help, "counter", labels}, series: make(map[string]*value)}}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the series of the label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.metricName + " decreased")
+	}
+	c.update(labelValues, func(v float64) float64 { return v + delta })
+}
+
+// Gauge is a value that goes up and down, per combination of label values
+type Gauge struct{ vector }
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vector{family: family{name, help, "gauge", labels}, series: make(map[string]*value)}}
+	r.register(g)
+	return g
+}
+
+// Set sets the series of the label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return v })
+}
+
+// gaugeFunc is a gauge without labels whose value is read when written
+type gaugeFunc struct {
+	family
+	read func() float64
+}
+
+// NewGaugeFunc registers a gauge that calls read for its value
+func (r *Registry) NewGaugeFunc(name, help string, read func() float64) {
+	r.register(&gaugeFunc{family{name, help, "gauge", nil}, read})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatValue(g.read()))
+}
+
+// histogramSeries is one series of a histogram
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations in buckets, per combination of label values
+type Histogram struct {
+	family
+	buckets []float64 // upper bounds, ascending
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds
+// and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name, help, "histogram", labels},
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[string]*histogramSeries),
+	}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe records a value in the series of the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := seriesKey(&h.family, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, found := h.series[key]
+	if !found {
+		s = &histogramSeries{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelPairs(h.labels, s.labels, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelPairs(h.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labelPairs(h.labels, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labelPairs(h.labels, s.labels), s.count)
+	}
+}
+
+// NewCounter registers a counter in the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a gauge in the default registry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGaugeFunc registers a gauge read from a function in the default registry
+func NewGaugeFunc(name, help string, read func() float64) {
+	Default.NewGaugeFunc(name, help, read)
+}
+
+// NewHistogram registers a histogram in the default registry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
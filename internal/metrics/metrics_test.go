@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests by route.\nSecond line.", "route", "status")
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/q"\`+"\n", "500")
+	r.NewGauge("test_temperature", "A gauge without labels.").Set(-1.5)
+	r.NewGaugeFunc("test_items", "Read when written.", func() float64 { return 42 })
+	latency := r.NewHistogram("test_latency_seconds", "Latencies.", []float64{1, 0.1}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		latency.Observe(v, "/a")
+	}
+	r.NewCounter("test_unused_total", "No series yet.")
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_items Read when written.
+# TYPE test_items gauge
+test_items 42
+# HELP test_latency_seconds Latencies.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 2
+test_latency_seconds_bucket{route="/a",le="1"} 3
+test_latency_seconds_bucket{route="/a",le="+Inf"} 4
+test_latency_seconds_sum{route="/a"} 3.65
+test_latency_seconds_count{route="/a"} 4
+# HELP test_requests_total Requests by route.\nSecond line.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",status="200"} 2
+test_requests_total{route="/b",status="200"} 1
+test_requests_total{route="/q\"\\\n",status="500"} 1
+# HELP test_temperature A gauge without labels.
+# TYPE test_temperature gauge
+test_temperature -1.5
+# HELP test_unused_total No series yet.
+# TYPE test_unused_total counter
+`
+	if got := buf.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	r := NewRegistry()
+	registerRuntime(r, time.Unix(1700000000, 0))
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\ngo_goroutines ", "\ngo_info{version=\"go", "\ngo_memstats_alloc_bytes ", "\nprocess_start_time_seconds 1.7e+09\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r.NewGauge("test_total", "")
+}
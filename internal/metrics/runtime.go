@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+func init() {
+	registerRuntime(Default, time.Now())
+}
+
+// registerRuntime adds the Go runtime and process stats to a registry. The
+// memory stats are read once per write, since reading them stops the world.
+func registerRuntime(r *Registry, start time.Time) {
+	r.NewGauge("go_info", "Information about the Go environment.", "version").Set(1, runtime.Version())
+	r.NewGauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.").Set(float64(start.UnixNano()) / 1e9)
+	goroutines := r.NewGauge("go_goroutines", "Number of goroutines that currently exist.")
+	alloc := r.NewGauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.")
+	sys := r.NewGauge("go_memstats_sys_bytes", "Number of bytes obtained from the system.")
+	heapObjects := r.NewGauge("go_memstats_heap_objects", "Number of allocated objects.")
+	lastGC := r.NewGauge("go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.")
+	gcCycles := r.NewCounter("go_gc_cycles_total", "Number of completed garbage collection cycles.")
+	gcPause := r.NewCounter("go_gc_pause_seconds_total", "Total time spent in garbage collection pauses.")
+
+	r.OnCollect(func() {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		goroutines.Set(float64(runtime.NumGoroutine()))
+		alloc.Set(float64(stats.Alloc))
+		sys.Set(float64(stats.Sys))
+		heapObjects.Set(float64(stats.HeapObjects))
+		lastGC.Set(float64(stats.LastGC) / 1e9)
+		gcCycles.update(nil, func(float64) float64 { return float64(stats.NumGC) })
+		gcPause.update(nil, func(float64) float64 { return float64(stats.PauseTotalNs) / 1e9 })
+	})
+}
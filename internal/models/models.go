@@ -2,9 +2,17 @@ package models
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
+// ConcertDateLayout is the date format used by the upstream API (dd-mm-yyyy)
+const ConcertDateLayout = "02-01-2006"
+
 // Artist represents a musical artist or band
 type Artist struct {
 	ID           int      `json:"id"`
@@ -17,7 +25,9 @@ type Artist struct {
 	ConcertDates string   `json:"concertDates"`
 	Relations    string   `json:"relations"`
 	// Additional fields for search
-	LocationList []string `json:"-"` // Will be populated from relations
+	LocationList []string `json:"-"`                 // Will be populated from relations
+	Aliases      []string `json:"aliases,omitempty"` // Synonyms from the alias file
+	Slug         string   `json:"slug,omitempty"`    // Unique URL path segment, see AssignSlugs
 }
 
 // Validate ensures the artist data is valid
@@ -35,6 +45,7 @@ func (a Artist) Validate() error {
 func (a Artist) GetSearchableText() string {
 	texts := []string{
 		a.Name,
+		strings.Join(a.Aliases, " "),
 		strings.Join(a.Members, " "),
 		a.FirstAlbum,
 		fmt.Sprintf("%d", a.CreationDate),
@@ -60,6 +71,58 @@ func CleanLocationName(location string) string {
 	return strings.Join(words, " ")
 }
 
+// Slug turns a name into a URL path segment such as "ac-dc": lowercase
+// letters and digits of any script with single dashes between words. The
+// name is NFC-normalized first, so "é" typed as one or two code points gives
+// the same slug.
+func Slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(norm.NFC.String(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// AssignSlugs gives every artist a unique slug, in ID order so a new artist
+// never takes the slug of an existing one. The first artist with a name gets
+// the plain slug; on any collision with a slug already issued the artist
+// gets its ID appended, then a counter. Slugs made only of digits would
+// read as IDs and get the ID appended too; names without letters or digits
+// become "artist-<id>".
+func AssignSlugs(artists []Artist) {
+	order := make([]int, len(artists))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return artists[order[a]].ID < artists[order[b]].ID })
+
+	issued := make(map[string]bool, len(artists))
+	for _, i := range order {
+		base := Slug(artists[i].Name)
+		slug := base
+		if base == "" || strings.Trim(base, "0123456789") == "" || issued[slug] {
+			if base == "" {
+				base = "artist"
+			}
+			slug = fmt.Sprintf("%s-%d", base, artists[i].ID)
+			for n := 2; issued[slug]; n++ {
+				slug = fmt.Sprintf("%s-%d-%d", base, artists[i].ID, n)
+			}
+		}
+		artists[i].Slug = slug
+		issued[slug] = true
+	}
+}
+
 // Location represents a concert location
 type Location struct {
 	ID        int      `json:"id"`
@@ -93,3 +156,98 @@ type Relation struct {
 type RelationIndex struct {
 	Index []Relation `json:"index"`
 }
+
+// Coordinates is a point on the globe in decimal degrees
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Concert is a single show of an artist at a location on a date
+type Concert struct {
+	ArtistID    int          `json:"artistId"`
+	Location    string       `json:"location"`
+	City        string       `json:"city,omitempty"`
+	Country     string       `json:"country,omitempty"`
+	Date        string       `json:"date"`
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+}
+
+// SplitLocation splits an upstream location such as "north_carolina-usa"
+// into its cleaned city and country
+func SplitLocation(location string) (city, country string) {
+	dash := strings.LastIndex(location, "-")
+	if dash < 0 {
+		return CleanLocationName(location), ""
+	}
+	return CleanLocationName(location[:dash]), CleanLocationName(location[dash+1:])
+}
+
+// LocationEntry is one location of the search index with the artists playing there
+type LocationEntry struct {
+	Name        string       `json:"name"`
+	ArtistIDs   []int        `json:"artistIds"`
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+}
+
+// ParseConcertDate parses an upstream concert date, ignoring the "*" marker
+func ParseConcertDate(date string) (time.Time, error) {
+	return time.Parse(ConcertDateLayout, strings.TrimPrefix(strings.TrimSpace(date), "*"))
+}
+
+// ISODate turns an upstream dd-mm-yyyy date into yyyy-mm-dd, keeping
+// anything it cannot parse as is
+func ISODate(date string) string {
+	t, err := ParseConcertDate(date)
+	if err != nil {
+		return date
+	}
+	return t.Format("2006-01-02")
+}
+
+// Time returns the concert date, or the zero time if it cannot be parsed
+func (c Concert) Time() time.Time {
+	t, _ := ParseConcertDate(c.Date)
+	return t
+}
+
+// Concerts flattens the relation into one concert per location and date,
+// sorted chronologically
+func (r Relation) Concerts() []Concert {
+	var concerts []Concert
+	for location, dates := range r.DatesLocations {
+		cleanedLocation := CleanLocationName(location)
+		city, country := SplitLocation(location)
+		for _, date := range dates {
+			concerts = append(concerts, Concert{
+				ArtistID: r.ID,
+				Location: cleanedLocation,
+				City:     city,
+				Country:  country,
+				Date:     strings.TrimPrefix(date, "*"),
+			})
+		}
+	}
+
+	SortConcerts(concerts)
+	return concerts
+}
+
+// SortConcerts sorts concerts chronologically, then by location
+func SortConcerts(concerts []Concert) {
+	sort.SliceStable(concerts, func(i, j int) bool {
+		ti, tj := concerts[i].Time(), concerts[j].Time()
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return concerts[i].Location < concerts[j].Location
+	})
+}
+
+// Snapshot is the upstream data as of one refresh.
+// A nil slice means that part has not been fetched yet.
+type Snapshot struct {
+	Time      time.Time  `json:"time"`
+	Artists   []Artist   `json:"artists"`
+	Relations []Relation `json:"relations"`
+}
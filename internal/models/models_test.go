@@ -1 +1,54 @@
 package models
+
+import "testing"
+
+func TestSlug(t *testing.T) {
+	for name, want := range map[string]string{
+		"Queen":                 "queen",
+		"AC/DC":                 "ac-dc",
+		"Guns N' Roses":         "guns-n-roses",
+		"  Earth, Wind & Fire ": "earth-wind-fire",
+		"blink-182":             "blink-182",
+		"Mötley Crüe":           "mötley-crüe",
+		"Мумий Тролль":          "мумий-тролль",
+		"Beyonce\u0301":         "beyoncé",
+		"Beyonc\u00e9":          "beyoncé",
+	} {
+		if got := Slug(name); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestAssignSlugs(t *testing.T) {
+	artists := []Artist{
+		{ID: 7, Name: "Queen"},
+		{ID: 3, Name: "queen"},
+		{ID: 4, Name: "311"},
+		{ID: 5, Name: "!!!"},
+		{ID: 9, Name: "Queen 7"},
+		{ID: 6, Name: "Queen-3"},
+	}
+	AssignSlugs(artists)
+
+	// A later artist whose plain slug was already issued as a suffixed one
+	// never pushes the earlier artist off it
+	want := []string{"queen-7", "queen", "311-4", "artist-5", "queen-7-9", "queen-3"}
+	for i, artist := range artists {
+		if artist.Slug != want[i] {
+			t.Errorf("%d %q: slug %q, want %q", artist.ID, artist.Name, artist.Slug, want[i])
+		}
+	}
+}
+
+func TestISODate(t *testing.T) {
+	for date, want := range map[string]string{
+		"21-07-1987":  "1987-07-21",
+		"*05-12-2019": "2019-12-05",
+		"soon":        "soon",
+	} {
+		if got := ISODate(date); got != want {
+			t.Errorf("ISODate(%q) = %q, want %q", date, got, want)
+		}
+	}
+}
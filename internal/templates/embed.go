@@ -0,0 +1,9 @@
+// Package templates holds the HTML templates, embedded into the binary
+package templates
+
+import "embed"
+
+// FS contains the *.html templates
+//
+//go:embed *.html
+var FS embed.FS
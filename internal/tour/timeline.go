@@ -0,0 +1,120 @@
+package tour
+
+import (
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+// DefaultLegGapDays is how many days without a concert start a new tour leg
+const DefaultLegGapDays = 30
+
+// dateLayout is the ISO date format used in timeline JSON
+const dateLayout = "2006-01-02"
+
+// Event is one concert on the timeline
+type Event struct {
+	Date        string              `json:"date"` // yyyy-mm-dd
+	Location    string              `json:"location"`
+	Coordinates *models.Coordinates `json:"coordinates,omitempty"`
+	Leg         int                 `json:"leg"`
+	Upcoming    bool                `json:"upcoming"`
+	time        time.Time
+}
+
+// Leg is a run of concerts without a gap longer than the leg gap.
+// A leg that crosses New Year appears in both years with the same number.
+type Leg struct {
+	Number int     `json:"number"`
+	Start  string  `json:"start"`
+	End    string  `json:"end"`
+	Events []Event `json:"events"`
+}
+
+// Year groups the legs of one calendar year
+type Year struct {
+	Year int   `json:"year"`
+	Legs []Leg `json:"legs"`
+}
+
+// Timeline is an artist's concerts in chronological order
+type Timeline struct {
+	ArtistID   int       `json:"artistId"`
+	LegGapDays int       `json:"legGapDays"`
+	Now        time.Time `json:"now"`
+	Legs       int       `json:"legs"`
+	Past       int       `json:"past"`
+	Upcoming   int       `json:"upcoming"`
+	Years      []Year    `json:"years"`
+	Undated    []string  `json:"undated,omitempty"` // dates that could not be parsed
+}
+
+// BuildTimeline sorts concerts by date, splits them into legs wherever two
+// consecutive concerts are more than legGapDays apart, groups them by year
+// and marks concerts on or after today as upcoming.
+func BuildTimeline(artistID int, concerts []models.Concert, legGapDays int, now time.Time) Timeline {
+	timeline := Timeline{
+		ArtistID:   artistID,
+		LegGapDays: legGapDays,
+		Now:        now,
+		Years:      []Year{},
+	}
+
+	// Concerts are all-day events, compare against the start of today
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	gap := time.Duration(legGapDays) * 24 * time.Hour
+
+	var previous time.Time
+	for _, concert := range sortedConcerts(concerts) {
+		t, err := models.ParseConcertDate(concert.Date)
+		if err != nil {
+			timeline.Undated = append(timeline.Undated, concert.Location+" "+concert.Date)
+			continue
+		}
+
+		if timeline.Legs == 0 || t.Sub(previous) > gap {
+			timeline.Legs++
+		}
+		previous = t
+
+		event := Event{
+			Date:        t.Format(dateLayout),
+			Location:    concert.Location,
+			Coordinates: concert.Coordinates,
+			Leg:         timeline.Legs,
+			Upcoming:    !t.Before(today),
+			time:        t,
+		}
+		if event.Upcoming {
+			timeline.Upcoming++
+		} else {
+			timeline.Past++
+		}
+		timeline.add(event)
+	}
+	return timeline
+}
+
+// add appends an event to its year and leg, creating them as needed
+func (tl *Timeline) add(event Event) {
+	if n := len(tl.Years); n == 0 || tl.Years[n-1].Year != event.time.Year() {
+		tl.Years = append(tl.Years, Year{Year: event.time.Year()})
+	}
+	year := &tl.Years[len(tl.Years)-1]
+
+	if n := len(year.Legs); n == 0 || year.Legs[n-1].Number != event.Leg {
+		year.Legs = append(year.Legs, Leg{Number: event.Leg, Start: event.Date})
+	}
+	leg := &year.Legs[len(year.Legs)-1]
+	leg.End = event.Date
+	leg.Events = append(leg.Events, event)
+}
+
+// sortedConcerts returns the concerts in chronological order without
+// modifying the input
+func sortedConcerts(concerts []models.Concert) []models.Concert {
+	sorted := make([]models.Concert, len(concerts))
+	copy(sorted, concerts)
+	models.SortConcerts(sorted)
+	return sorted
+}
@@ -0,0 +1,46 @@
+package tour
+
+import (
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/models"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	concerts := []models.Concert{
+		{Location: "Paris France", Date: "05-01-2020"},
+		{Location: "London Uk", Date: "28-12-2019"},
+		{Location: "Berlin Germany", Date: "10-06-2020"},
+		{Location: "Tokyo Japan", Date: "01-07-2020"},
+		{Location: "Nowhere", Date: "not a date"},
+	}
+	now := time.Date(2020, 6, 10, 15, 0, 0, 0, time.UTC)
+
+	timeline := BuildTimeline(7, concerts, 30, now)
+
+	if timeline.Legs != 2 {
+		t.Errorf("Legs = %d, want 2 (Dec-Jan and Jun-Jul)", timeline.Legs)
+	}
+	if timeline.Past != 2 || timeline.Upcoming != 2 {
+		t.Errorf("Past, Upcoming = %d, %d, want 2, 2 (today counts as upcoming)", timeline.Past, timeline.Upcoming)
+	}
+	if len(timeline.Undated) != 1 {
+		t.Errorf("Undated = %v, want the unparseable date", timeline.Undated)
+	}
+	if len(timeline.Years) != 2 || timeline.Years[0].Year != 2019 || timeline.Years[1].Year != 2020 {
+		t.Fatalf("Years = %+v, want 2019 and 2020", timeline.Years)
+	}
+
+	// The first leg crosses New Year and shows up in both years
+	if leg := timeline.Years[0].Legs[0]; leg.Number != 1 || leg.Events[0].Date != "2019-12-28" {
+		t.Errorf("2019 leg = %+v", leg)
+	}
+	legs2020 := timeline.Years[1].Legs
+	if len(legs2020) != 2 || legs2020[0].Number != 1 || legs2020[1].Number != 2 {
+		t.Fatalf("2020 legs = %+v, want legs 1 and 2", legs2020)
+	}
+	if leg := legs2020[1]; leg.Start != "2020-06-10" || leg.End != "2020-07-01" || !leg.Events[0].Upcoming {
+		t.Errorf("second leg = %+v", leg)
+	}
+}
@@ -0,0 +1,488 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"groupie-tracker/internal/changes"
+)
+
+// Event types a subscription can ask for
+const (
+	EventArtistAdded    = "artist.added"
+	EventArtistRemoved  = "artist.removed"
+	EventMembersChanged = "members.changed"
+	EventDatesAdded     = "dates.added"
+	EventDatesRemoved   = "dates.removed"
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderEvent     = "X-Groupie-Event"
+	HeaderDelivery  = "X-Groupie-Delivery"
+	HeaderTimestamp = "X-Groupie-Timestamp" // Unix seconds when the attempt was signed
+	HeaderSignature = "X-Groupie-Signature" // "sha256=" + hex HMAC of timestamp + "." + body
+)
+
+// SignatureTolerance is how far a delivery's timestamp may be from the
+// receiver's clock before Verify rejects it as a replay
+const SignatureTolerance = 5 * time.Minute
+
+// maxRecent bounds how many deliveries and dead letters are kept in memory
+const maxRecent = 100
+
+// Subscription is one configured webhook receiver
+type Subscription struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret"`
+	Events    []string `json:"events"`              // empty means every event
+	Artists   []int    `json:"artists,omitempty"`   // only these artist IDs
+	Locations []string `json:"locations,omitempty"` // only dates at locations containing one of these
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID       string      `json:"id"`
+	Event    string      `json:"event"`
+	Time     time.Time   `json:"time"`
+	ChangeID int         `json:"changeId"`
+	Data     interface{} `json:"data"`
+}
+
+// Delivery is the state of one payload sent to one subscription
+type Delivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscriptionId"`
+	Event          string    `json:"event"`
+	URL            string    `json:"url"`
+	Status         string    `json:"status"` // pending, delivered or failed
+	Attempts       int       `json:"attempts"`
+	ResponseCode   int       `json:"responseCode,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Created        time.Time `json:"created"`
+	LastAttempt    time.Time `json:"lastAttempt,omitempty"`
+}
+
+// Dispatcher turns changes into signed webhook deliveries with retries
+type Dispatcher struct {
+	subscriptions  []Subscription
+	client         *http.Client
+	maxAttempts    int
+	backoff        time.Duration // delay before the first retry, doubled for each further retry
+	deadLetterPath string        // JSON lines file of failed deliveries, empty to skip
+
+	deliveries  []*Delivery // newest last
+	deadLetters []Delivery  // newest last
+	mutex       sync.RWMutex
+
+	ctx     context.Context // cancelled by Stop, ending requests and retry waits
+	cancel  context.CancelFunc
+	pending sync.WaitGroup
+}
+
+var dispatcher = NewDispatcher(nil)
+
+// Init loads the subscriptions from a JSON file and writes failed
+// deliveries to the data directory
+func Init(path, dataDir string) error {
+	subscriptions, err := LoadSubscriptions(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+
+	dispatcher = NewDispatcher(subscriptions)
+	dispatcher.deadLetterPath = filepath.Join(dataDir, "webhooks-dead-letter.jsonl")
+	if len(subscriptions) > 0 {
+		slog.Info("Loaded webhook subscriptions", "count", len(subscriptions))
+	}
+	return nil
+}
+
+// Dispatch sends a change to the configured subscriptions
+func Dispatch(change changes.Change) { dispatcher.Dispatch(change) }
+
+// Deliveries returns the recent deliveries of the configured subscriptions
+func Deliveries() []Delivery { return dispatcher.Deliveries() }
+
+// DeadLetters returns the recent failed deliveries of the configured subscriptions
+func DeadLetters() []Delivery { return dispatcher.DeadLetters() }
+
+// Stop cancels in-flight and pending deliveries of the configured
+// subscriptions, writing them to the dead letter file, and waits for them
+func Stop() { dispatcher.Stop() }
+
+// NewDispatcher creates a dispatcher for the given subscriptions. Redirects
+// are not followed: they would turn the signed POST into a GET to another
+// host, so a 3xx answer is a failed delivery.
+func NewDispatcher(subscriptions []Subscription) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		subscriptions: subscriptions,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts: 5,
+		backoff:     2 * time.Second,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// LoadSubscriptions reads subscriptions from a JSON file. A missing file means none.
+func LoadSubscriptions(path string) ([]Subscription, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptions []Subscription
+	if err := json.Unmarshal(data, &subscriptions); err != nil {
+		return nil, err
+	}
+	for i, sub := range subscriptions {
+		if sub.ID == "" || sub.URL == "" {
+			return nil, fmt.Errorf("subscription %d: id and url are required", i+1)
+		}
+		if sub.Secret == "" {
+			return nil, fmt.Errorf("subscription %s: secret is required to sign deliveries", sub.ID)
+		}
+		if !strings.HasPrefix(sub.URL, "http://") && !strings.HasPrefix(sub.URL, "https://") {
+			return nil, fmt.Errorf("subscription %s: url must be http or https", sub.ID)
+		}
+		for _, event := range sub.Events {
+			if !validEvent(event) {
+				return nil, fmt.Errorf("subscription %s: unknown event %q", sub.ID, event)
+			}
+		}
+	}
+	return subscriptions, nil
+}
+
+func validEvent(event string) bool {
+	switch event {
+	case EventArtistAdded, EventArtistRemoved, EventMembersChanged, EventDatesAdded, EventDatesRemoved:
+		return true
+	}
+	return false
+}
+
+// Dispatch queues a delivery for every subscription interested in the change.
+// It returns immediately, deliveries happen in the background.
+func (d *Dispatcher) Dispatch(change changes.Change) {
+	for _, sub := range d.subscriptions {
+		for event, data := range sub.filter(change) {
+			payload := Payload{ID: newID(), Event: event, Time: change.Time, ChangeID: change.ID, Data: data}
+			body, err := json.Marshal(payload)
+			if err != nil {
+				slog.Error("Encoding webhook payload failed", "subscription", sub.ID, "event", event, "err", err)
+				continue
+			}
+
+			delivery := &Delivery{
+				ID:             payload.ID,
+				SubscriptionID: sub.ID,
+				Event:          event,
+				URL:            sub.URL,
+				Status:         "pending",
+				Created:        time.Now(),
+			}
+			d.track(delivery)
+
+			d.pending.Add(1)
+			go d.deliver(sub, delivery, body)
+		}
+	}
+}
+
+// filter returns the payload data per event type, limited to what the subscription wants
+func (sub Subscription) filter(change changes.Change) map[string]interface{} {
+	wantsEvent := func(event string) bool {
+		if len(sub.Events) == 0 {
+			return true
+		}
+		for _, e := range sub.Events {
+			if e == event {
+				return true
+			}
+		}
+		return false
+	}
+	wantsArtist := func(id int) bool {
+		if len(sub.Artists) == 0 {
+			return true
+		}
+		for _, a := range sub.Artists {
+			if a == id {
+				return true
+			}
+		}
+		return false
+	}
+	wantsLocation := func(location string) bool {
+		if len(sub.Locations) == 0 {
+			return true
+		}
+		for _, l := range sub.Locations {
+			if strings.Contains(strings.ToLower(location), strings.ToLower(l)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	artists := func(refs []changes.ArtistRef) []changes.ArtistRef {
+		var out []changes.ArtistRef
+		for _, ref := range refs {
+			if wantsArtist(ref.ID) {
+				out = append(out, ref)
+			}
+		}
+		return out
+	}
+	concerts := func(refs []changes.ConcertRef) []changes.ConcertRef {
+		var out []changes.ConcertRef
+		for _, ref := range refs {
+			if wantsArtist(ref.ArtistID) && wantsLocation(ref.Location) {
+				out = append(out, ref)
+			}
+		}
+		return out
+	}
+
+	data := make(map[string]interface{})
+	if added := artists(change.ArtistsAdded); len(added) > 0 && wantsEvent(EventArtistAdded) {
+		data[EventArtistAdded] = added
+	}
+	if removed := artists(change.ArtistsRemoved); len(removed) > 0 && wantsEvent(EventArtistRemoved) {
+		data[EventArtistRemoved] = removed
+	}
+	var members []changes.MemberChange
+	for _, m := range change.MembersChanged {
+		if wantsArtist(m.ArtistID) {
+			members = append(members, m)
+		}
+	}
+	if len(members) > 0 && wantsEvent(EventMembersChanged) {
+		data[EventMembersChanged] = members
+	}
+	if added := concerts(change.DatesAdded); len(added) > 0 && wantsEvent(EventDatesAdded) {
+		data[EventDatesAdded] = added
+	}
+	if removed := concerts(change.DatesRemoved); len(removed) > 0 && wantsEvent(EventDatesRemoved) {
+		data[EventDatesRemoved] = removed
+	}
+	return data
+}
+
+// deliver posts the payload, retrying with exponential backoff
+func (d *Dispatcher) deliver(sub Subscription, delivery *Delivery, body []byte) {
+	defer d.pending.Done()
+
+	wait := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		code, err := d.post(sub, delivery, body)
+
+		d.mutex.Lock()
+		delivery.Attempts = attempt
+		delivery.LastAttempt = time.Now()
+		delivery.ResponseCode = code
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Status = "delivered"
+		}
+		d.mutex.Unlock()
+
+		if err == nil {
+			return
+		}
+		if d.ctx.Err() != nil {
+			d.fail(delivery, "stopped before delivery succeeded")
+			return
+		}
+		if attempt == d.maxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-d.ctx.Done():
+			d.fail(delivery, "stopped before delivery succeeded")
+			return
+		}
+	}
+
+	d.fail(delivery, "")
+}
+
+// post sends one attempt, signed with the current time, and returns the
+// response status
+func (d *Dispatcher) post(sub Subscription, delivery *Delivery, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, "POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "groupie-tracker-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for a body sent at a Unix time.
+// The timestamp is signed too, so a captured delivery cannot be replayed
+// once it is older than SignatureTolerance.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the timestamp and signature headers of a delivery the way a
+// receiver should: the signature must match and the timestamp must be
+// within SignatureTolerance of now
+func Verify(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("timestamp is %s off, more than %s", age.Round(time.Second), SignatureTolerance)
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+// fail marks a delivery as failed and moves it to the dead-letter log
+func (d *Dispatcher) fail(delivery *Delivery, reason string) {
+	d.mutex.Lock()
+	delivery.Status = "failed"
+	if reason != "" {
+		delivery.Error = reason
+	}
+	dead := *delivery
+	d.deadLetters = append(d.deadLetters, dead)
+	if len(d.deadLetters) > maxRecent {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-maxRecent:]
+	}
+	path := d.deadLetterPath
+	d.mutex.Unlock()
+
+	slog.Warn("Webhook delivery failed", "delivery", dead.ID, "url", dead.URL, "attempts", dead.Attempts, "err", dead.Error)
+	if path != "" {
+		if err := appendJSONLine(path, dead); err != nil {
+			slog.Error("Writing webhook dead letter failed", "path", path, "err", err)
+		}
+	}
+}
+
+// track remembers a delivery for the admin listing
+func (d *Dispatcher) track(delivery *Delivery) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxRecent {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxRecent:]
+	}
+}
+
+// Deliveries returns the most recent deliveries, newest first
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	list := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		list = append(list, *d.deliveries[i])
+	}
+	return list
+}
+
+// DeadLetters returns the most recent failed deliveries, newest first
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	list := make([]Delivery, 0, len(d.deadLetters))
+	for i := len(d.deadLetters) - 1; i >= 0; i-- {
+		list = append(list, d.deadLetters[i])
+	}
+	return list
+}
+
+// Wait blocks until every queued delivery has succeeded or failed
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// Stop cancels in-flight requests and pending retries, failing their
+// deliveries, and waits for them to finish. Calling it again only waits.
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	d.pending.Wait()
+}
+
+// newID returns a random delivery ID
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// appendJSONLine appends v as one JSON line to a file
+func appendJSONLine(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,249 @@
+package webhooks
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"groupie-tracker/internal/changes"
+)
+
+// received is one request seen by the test receiver
+type received struct {
+	event, timestamp, signature string
+	body                        []byte
+}
+
+// startReceiver answers with the given status codes in turn (200 once they run out)
+func startReceiver(t *testing.T, codes ...int) (*httptest.Server, func() []received) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, received{r.Header.Get(HeaderEvent), r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body})
+		n := len(requests)
+		mutex.Unlock()
+
+		if n <= len(codes) {
+			w.WriteHeader(codes[n-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []received {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]received(nil), requests...)
+	}
+}
+
+func testChange() changes.Change {
+	return changes.Change{
+		ID:           7,
+		Time:         time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		ArtistsAdded: []changes.ArtistRef{{ID: 3, Name: "Pink Floyd"}, {ID: 9, Name: "Queen"}},
+		DatesAdded: []changes.ConcertRef{
+			{ArtistID: 3, ArtistName: "Pink Floyd", Location: "London Uk", Date: "05-06-2024"},
+			{ArtistID: 3, ArtistName: "Pink Floyd", Location: "Paris France", Date: "08-06-2024"},
+			{ArtistID: 9, ArtistName: "Queen", Location: "London Uk", Date: "10-06-2024"},
+		},
+	}
+}
+
+func TestDispatchSignsAndFilters(t *testing.T) {
+	server, requests := startReceiver(t)
+	d := NewDispatcher([]Subscription{{
+		ID:        "london",
+		URL:       server.URL,
+		Secret:    "s3cret",
+		Events:    []string{EventDatesAdded},
+		Artists:   []int{3},
+		Locations: []string{"london"},
+	}})
+	d.Dispatch(testChange())
+	d.Wait()
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	if got[0].event != EventDatesAdded {
+		t.Errorf("event header = %q", got[0].event)
+	}
+	if err := Verify("s3cret", got[0].timestamp, got[0].signature, got[0].body, time.Now()); err != nil {
+		t.Errorf("signature %q at %s: %v", got[0].signature, got[0].timestamp, err)
+	}
+
+	var payload struct {
+		Event    string               `json:"event"`
+		ChangeID int                  `json:"changeId"`
+		Data     []changes.ConcertRef `json:"data"`
+	}
+	if err := json.Unmarshal(got[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ChangeID != 7 || len(payload.Data) != 1 || payload.Data[0].Location != "London Uk" || payload.Data[0].ArtistID != 3 {
+		t.Errorf("payload = %+v, want only Pink Floyd in London", payload)
+	}
+
+	deliveries := d.Deliveries()
+	if len(deliveries) != 1 || deliveries[0].Status != "delivered" || deliveries[0].Attempts != 1 {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	server, requests := startReceiver(t, 500, 503)
+	d := NewDispatcher([]Subscription{{ID: "all", URL: server.URL, Events: []string{EventArtistAdded}}})
+	d.backoff = time.Millisecond
+	d.Dispatch(testChange())
+	d.Wait()
+
+	if n := len(requests()); n != 3 {
+		t.Fatalf("receiver got %d requests, want 3", n)
+	}
+	deliveries := d.Deliveries()
+	if len(deliveries) != 1 || deliveries[0].Status != "delivered" || deliveries[0].Attempts != 3 || deliveries[0].ResponseCode != 200 {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Errorf("dead letters = %+v, want none", d.DeadLetters())
+	}
+}
+
+func TestDispatchDeadLetter(t *testing.T) {
+	server, requests := startReceiver(t, 500, 500, 500)
+	d := NewDispatcher([]Subscription{{ID: "broken", URL: server.URL, Events: []string{EventArtistAdded}}})
+	d.backoff = time.Millisecond
+	d.maxAttempts = 3
+	d.deadLetterPath = filepath.Join(t.TempDir(), "dead.jsonl")
+	d.Dispatch(testChange())
+	d.Wait()
+
+	if n := len(requests()); n != 3 {
+		t.Fatalf("receiver got %d requests, want 3", n)
+	}
+	dead := d.DeadLetters()
+	if len(dead) != 1 || dead[0].Status != "failed" || dead[0].Attempts != 3 || dead[0].ResponseCode != 500 {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+
+	f, err := os.Open(d.deadLetterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []Delivery
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var delivery Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &delivery); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, delivery)
+	}
+	if len(lines) != 1 || lines[0].ID != dead[0].ID {
+		t.Errorf("dead-letter log = %+v", lines)
+	}
+}
+
+func TestLoadSubscriptionsRejectsUnknownEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	os.WriteFile(path, []byte(`[{"id":"a","url":"http://example.com","secret":"s","events":["artist.renamed"]}]`), 0o644)
+	if _, err := LoadSubscriptions(path); err == nil {
+		t.Error("expected an error for an unknown event")
+	}
+
+	os.WriteFile(path, []byte(`[{"id":"a","url":"http://example.com"}]`), 0o644)
+	if _, err := LoadSubscriptions(path); err == nil {
+		t.Error("expected an error for a subscription without a secret")
+	}
+
+	subscriptions, err := LoadSubscriptions(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || subscriptions != nil {
+		t.Errorf("missing file = %v, %v, want no subscriptions", subscriptions, err)
+	}
+}
+
+func TestDispatchDoesNotFollowRedirects(t *testing.T) {
+	target, targetRequests := startReceiver(t)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	d := NewDispatcher([]Subscription{{ID: "moved", URL: redirect.URL, Secret: "s3cret", Events: []string{EventArtistAdded}}})
+	d.backoff = time.Millisecond
+	d.maxAttempts = 1
+	d.Dispatch(testChange())
+	d.Wait()
+
+	if n := len(targetRequests()); n != 0 {
+		t.Errorf("the redirect target got %d requests, want none", n)
+	}
+	if dead := d.DeadLetters(); len(dead) != 1 || dead[0].ResponseCode != http.StatusFound {
+		t.Errorf("dead letters = %+v, want the 302 as a failed delivery", dead)
+	}
+
+	// Stopping twice does not panic
+	d.Stop()
+	d.Stop()
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sent := time.Unix(1714557600, 0)
+	signature := Sign("s3cret", sent.Unix(), body)
+
+	if err := Verify("s3cret", "1714557600", signature, body, sent.Add(time.Minute)); err != nil {
+		t.Errorf("fresh delivery: %v", err)
+	}
+	for name, err := range map[string]error{
+		"replayed later":  Verify("s3cret", "1714557600", signature, body, sent.Add(SignatureTolerance+time.Second)),
+		"other timestamp": Verify("s3cret", "1714557601", signature, body, sent),
+		"other body":      Verify("s3cret", "1714557600", signature, []byte(`{"id":"2"}`), sent),
+		"other secret":    Verify("guess", "1714557600", signature, body, sent),
+	} {
+		if err == nil {
+			t.Errorf("%s: verified, want an error", name)
+		}
+	}
+}
+
+func TestStopCancelsInFlightDelivery(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body) // the server notices the client leaving only once the body is read
+		started <- struct{}{}
+		<-r.Context().Done() // hang until the dispatcher gives up
+	}))
+	defer server.Close()
+
+	d := NewDispatcher([]Subscription{{ID: "slow", URL: server.URL, Secret: "s3cret", Events: []string{EventArtistAdded}}})
+	d.Dispatch(testChange())
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop waited for the hanging receiver")
+	}
+	if dead := d.DeadLetters(); len(dead) != 1 || dead[0].Error != "stopped before delivery succeeded" {
+		t.Errorf("dead letters = %+v, want the cancelled delivery", dead)
+	}
+}
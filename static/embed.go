@@ -0,0 +1,10 @@
+// Package static holds the stylesheets, scripts and images served under
+// /static/, embedded into the binary
+package static
+
+import "embed"
+
+// FS contains the css, js and images directories
+//
+//go:embed css js images
+var FS embed.FS
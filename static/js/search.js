@@ -38,6 +38,27 @@ class SearchManager {
     this.searchInput.addEventListener('focus', () => this.showSuggestions());
     this.searchInput.addEventListener('blur', () => this.hideSuggestions());
     
+    // Buttons say what they do with data-action: the Content-Security-Policy
+    // blocks inline onclick handlers
+    document.addEventListener('click', (e) => {
+      const button = e.target.closest('[data-action]');
+      if (!button) return;
+      switch (button.dataset.action) {
+        case 'clear-filters':
+          this.clearFilters();
+          break;
+        case 'near-me':
+          this.searchNearMe();
+          break;
+        case 'retry':
+          this.loadArtists();
+          break;
+        case 'view-artist':
+          goToArtist(button.dataset.artist);
+          break;
+      }
+    });
+
     // Keyboard shortcut: '/' to focus search (only when search is not focused)
     document.addEventListener('keydown', (e) => {
       if (e.key === '/' && document.activeElement !== this.searchInput) {
@@ -106,6 +127,7 @@ class SearchManager {
     this.filteredArtists = this.allArtists.filter(artist => {
       return (
         artist.name.toLowerCase().includes(queryLower) ||
+        (artist.aliases || []).some(alias => alias.toLowerCase().includes(queryLower)) ||
         artist.members.some(member => member.toLowerCase().includes(queryLower)) ||
         artist.firstAlbum.toLowerCase().includes(queryLower) ||
         artist.creationDate.toString().includes(queryLower)
@@ -142,6 +164,41 @@ class SearchManager {
     }
   }
 
+  searchNearMe() {
+    if (!navigator.geolocation) {
+      showAlert('Your browser cannot share its location.', 'warning');
+      return;
+    }
+
+    const radiusKm = document.getElementById('nearRadius').value;
+    this.showLoading('Finding your location...');
+    navigator.geolocation.getCurrentPosition(
+      (position) => this.performNearSearch(position.coords.latitude, position.coords.longitude, radiusKm),
+      () => {
+        this.hideLoading();
+        showAlert('Location access was denied. Allow it to find concerts near you.', 'warning');
+      }
+    );
+  }
+
+  async performNearSearch(lat, lon, radiusKm) {
+    try {
+      this.showLoading('Searching concerts near you...');
+      const response = await fetch(`/api/concerts/near?lat=${lat}&lon=${lon}&radiusKm=${radiusKm}`);
+      if (!response.ok) throw new Error('Nearby search failed');
+
+      const result = await response.json();
+      this.filteredArtists = result.artists;
+      this.renderArtists();
+      this.hideLoading();
+      showAlert(`Found ${result.artists.length} artist(s) with ${result.concerts.length} concert(s) within ${radiusKm} km`, 'success');
+    } catch (error) {
+      console.error('Nearby search error:', error);
+      this.hideLoading();
+      showAlert('Nearby search failed. Please try again.', 'warning');
+    }
+  }
+
   showSuggestions(query = '') {
     if (!query) {
       this.hideSuggestions();
@@ -162,6 +219,13 @@ class SearchManager {
       if (artist.name.toLowerCase().includes(queryLower)) {
         results.push({ text: artist.name, type: 'artist/band', artistId: artist.id });
       }
+
+      // Check aliases, but suggest the canonical name
+      (artist.aliases || []).forEach(alias => {
+        if (alias.toLowerCase().includes(queryLower)) {
+          results.push({ text: artist.name, type: 'artist/band', artistId: artist.id });
+        }
+      });
       
       // Check members
       artist.members.forEach(member => {
@@ -282,7 +346,7 @@ class SearchManager {
       this.artistList.innerHTML = `
         <div class="no-results">
           <p>No artists found matching your search.</p>
-          <button class="btn btn-secondary" onclick="searchManager.clearFilters()">Clear Search</button>
+          <button class="btn btn-secondary" data-action="clear-filters">Clear Search</button>
         </div>
       `;
       return;
@@ -299,8 +363,9 @@ class SearchManager {
             <strong>Members:</strong> ${artist.members.join(', ')}<br>
             <strong>Creation Date:</strong> ${artist.creationDate}<br>
             <strong>First Album:</strong> ${artist.firstAlbum || 'Unknown'}
+            ${artist.distanceKm !== undefined ? `<br><strong>Nearest Concert:</strong> ${Math.round(artist.distanceKm)} km` : ''}
           </p>
-          <button class="btn btn-primary" onclick="goToArtist(${artist.id})">View Details</button>
+          <button class="btn btn-primary" data-action="view-artist" data-artist="${artist.slug || artist.id}">View Details</button>
         </div>
       `;
       this.artistList.appendChild(artistCard);
@@ -342,7 +407,7 @@ class SearchManager {
       this.alertContainer.innerHTML = `
         <div class="alert alert-danger">
           <p>${message}</p>
-          ${retryCallback ? `<button class="btn btn-secondary" onclick="searchManager.loadArtists()">Retry</button>` : ''}
+          ${retryCallback ? `<button class="btn btn-secondary" data-action="retry">Retry</button>` : ''}
         </div>
       `;
     }
@@ -357,8 +422,8 @@ document.addEventListener('DOMContentLoaded', () => {
 });
 
 // Utility functions
-function goToArtist(artistId) {
-  window.location.href = `/artist/${artistId}`;
+function goToArtist(artist) {
+  window.location.href = `/artist/${encodeURIComponent(artist)}`;
 }
 
 async function fetchArtists() {
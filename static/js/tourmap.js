@@ -0,0 +1,121 @@
+// Tour map: draws an artist's concerts on an SVG world outline.
+// Uses an equirectangular projection, so x = longitude and y = -latitude.
+const SVG_NS = 'http://www.w3.org/2000/svg';
+
+class TourMap {
+  constructor(container) {
+    this.container = container;
+    this.artistId = container.dataset.artistId;
+  }
+
+  async load() {
+    try {
+      const response = await fetch(`/api/artists/${this.artistId}/concerts.geojson`);
+      if (!response.ok) throw new Error('Failed to fetch concerts');
+      this.render(await response.json());
+    } catch (error) {
+      console.error('Tour map error:', error);
+      this.container.innerHTML = '<p class="text-muted">The tour map is not available right now.</p>';
+    }
+  }
+
+  render(geojson) {
+    const points = geojson.features.filter(f => f.geometry.type === 'Point');
+    const route = geojson.features.find(f => f.geometry.type === 'LineString');
+
+    if (points.length === 0) {
+      this.container.innerHTML = '<p class="text-muted">No concert locations to show on the map.</p>';
+      return;
+    }
+
+    const bounds = this.fitBounds(points);
+    const svg = this.element('svg', {
+      class: 'tour-map-svg',
+      viewBox: `${bounds.x} ${bounds.y} ${bounds.width} ${bounds.height}`,
+      role: 'img',
+      'aria-label': 'Map of the tour route'
+    });
+
+    svg.appendChild(this.element('rect', {
+      class: 'tour-map-sea', x: -180, y: -90, width: 360, height: 180
+    }));
+    WORLD_OUTLINE.forEach(polygon => {
+      svg.appendChild(this.element('polygon', {
+        class: 'tour-map-land',
+        points: polygon.map(([lon, lat]) => `${lon},${-lat}`).join(' ')
+      }));
+    });
+
+    if (route) {
+      svg.appendChild(this.element('polyline', {
+        class: 'tour-map-route',
+        points: route.geometry.coordinates.map(([lon, lat]) => `${lon},${-lat}`).join(' ')
+      }));
+    }
+
+    // Concerts at the same place share one marker labelled with the first show
+    const radius = bounds.width / 80;
+    this.groupByPosition(points).forEach(group => {
+      const [lon, lat] = group[0].geometry.coordinates;
+      const marker = this.element('g', { class: 'tour-map-marker' });
+      const title = this.element('title', {});
+      title.textContent = group
+        .map(f => `#${f.properties.order} ${f.properties.location} — ${f.properties.date}`)
+        .join('\n');
+      marker.appendChild(title);
+      marker.appendChild(this.element('circle', { cx: lon, cy: -lat, r: radius }));
+      const label = this.element('text', {
+        x: lon, y: -lat, 'font-size': radius * 1.2, 'text-anchor': 'middle', 'dominant-baseline': 'central'
+      });
+      label.textContent = group[0].properties.order;
+      marker.appendChild(label);
+      svg.appendChild(marker);
+    });
+
+    this.container.innerHTML = '';
+    this.container.appendChild(svg);
+  }
+
+  // fitBounds returns a viewBox around the markers with some padding
+  fitBounds(points) {
+    const lons = points.map(f => f.geometry.coordinates[0]);
+    const lats = points.map(f => f.geometry.coordinates[1]);
+    const minX = Math.min(...lons), maxX = Math.max(...lons);
+    const minY = -Math.max(...lats), maxY = -Math.min(...lats);
+
+    // Never zoom in closer than 30° wide, keep a 2:1 aspect ratio
+    const width = Math.max(maxX - minX, 30) * 1.2;
+    const height = Math.max(maxY - minY + width * 0.1, width / 2);
+    const centerX = (minX + maxX) / 2, centerY = (minY + maxY) / 2;
+
+    return {
+      x: Math.max(-180, Math.min(180 - width, centerX - width / 2)),
+      y: Math.max(-90, Math.min(90 - height, centerY - height / 2)),
+      width: Math.min(width, 360),
+      height: Math.min(height, 180)
+    };
+  }
+
+  groupByPosition(points) {
+    const groups = new Map();
+    points.forEach(feature => {
+      const key = feature.geometry.coordinates.join(',');
+      if (!groups.has(key)) groups.set(key, []);
+      groups.get(key).push(feature);
+    });
+    return [...groups.values()];
+  }
+
+  element(name, attributes) {
+    const el = document.createElementNS(SVG_NS, name);
+    Object.entries(attributes).forEach(([key, value]) => el.setAttribute(key, value));
+    return el;
+  }
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+  const container = document.getElementById('tourMap');
+  if (container) {
+    new TourMap(container).load();
+  }
+});
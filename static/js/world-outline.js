@@ -0,0 +1,39 @@
+// Coarse world coastline for the tour map, as [lon, lat] polygons.
+// Deliberately low resolution: it only gives markers geographic context.
+const WORLD_OUTLINE = [
+  // North America
+  [[-168,66],[-162,70],[-150,71],[-140,70],[-128,70],[-115,68],[-95,72],[-85,70],[-80,63],[-93,58],[-90,57],[-80,55],[-78,62],[-70,60],[-64,60],[-56,52],[-66,45],[-70,42],[-74,40],[-76,35],[-81,31],[-80,25],[-82,27],[-85,30],[-90,29],[-94,29],[-97,26],[-97,21],[-94,18],[-90,21],[-87,21],[-88,16],[-84,15],[-83,10],[-79,9],[-77,8],[-80,7],[-86,12],[-92,14],[-97,16],[-105,20],[-106,23],[-112,29],[-114,31],[-110,23],[-115,28],[-117,33],[-121,35],[-124,40],[-124,46],[-123,49],[-130,55],[-136,58],[-146,61],[-152,59],[-158,56],[-165,55],[-158,58],[-164,60],[-166,62],[-165,64],[-168,66]],
+  // Greenland
+  [[-55,60],[-43,60],[-40,65],[-22,70],[-20,76],[-18,81],[-35,83],[-60,82],[-72,78],[-67,76],[-58,75],[-55,70],[-53,66],[-55,60]],
+  // Cuba
+  [[-85,22],[-80,23],[-74,20],[-77,20],[-85,22]],
+  // South America
+  [[-77,8],[-72,12],[-64,10],[-60,8],[-52,5],[-50,0],[-44,-2],[-35,-5],[-35,-9],[-39,-15],[-41,-22],[-48,-26],[-53,-33],[-58,-34],[-57,-38],[-62,-39],[-65,-42],[-66,-47],[-69,-51],[-68,-55],[-72,-53],[-75,-48],[-73,-40],[-72,-30],[-70,-18],[-76,-14],[-81,-5],[-80,0],[-77,4],[-77,8]],
+  // Africa
+  [[-17,21],[-13,28],[-9,32],[-6,36],[3,37],[10,37],[11,33],[20,31],[25,32],[32,31],[34,28],[37,22],[39,16],[43,12],[51,12],[48,5],[40,-3],[39,-10],[41,-15],[35,-23],[33,-27],[27,-34],[20,-35],[18,-32],[15,-27],[12,-18],[14,-11],[12,-5],[9,1],[9,4],[4,6],[-2,5],[-8,4],[-13,8],[-17,14],[-17,21]],
+  // Madagascar
+  [[49,-12],[50,-16],[47,-25],[44,-24],[44,-17],[49,-12]],
+  // Eurasia
+  [[-9,37],[-9,43],[-2,43],[-1,46],[-4,48],[2,51],[5,53],[8,54],[8,57],[10,57],[11,54],[14,54],[20,55],[21,57],[24,59],[28,60],[23,61],[22,65],[25,66],[18,62],[17,58],[12,56],[10,59],[5,58],[5,62],[12,66],[16,69],[25,71],[33,70],[41,67],[44,68],[55,68],[60,69],[68,73],[73,72],[80,73],[87,75],[100,77],[113,74],[128,73],[140,72],[150,71],[160,70],[170,70],[180,69],[180,65],[178,62],[170,60],[163,60],[160,54],[156,51],[156,57],[163,62],[155,59],[142,59],[137,54],[141,53],[140,48],[135,43],[130,42],[129,35],[127,35],[126,38],[125,40],[121,39],[122,37],[119,35],[122,31],[121,28],[117,24],[111,21],[108,22],[106,18],[109,12],[105,9],[103,10],[100,13],[100,8],[103,3],[104,1],[101,3],[98,8],[98,16],[94,19],[92,22],[88,22],[86,20],[80,15],[80,10],[77,8],[73,16],[73,21],[69,23],[66,25],[57,25],[56,27],[52,28],[48,30],[50,27],[56,26],[59,22],[55,17],[52,16],[45,13],[43,13],[39,21],[35,28],[34,31],[35,36],[30,36],[27,37],[26,40],[29,41],[41,41],[41,44],[38,45],[33,45],[30,46],[28,44],[28,41],[23,40],[24,38],[22,37],[21,39],[19,42],[16,43],[13,45],[12,44],[16,41],[18,40],[16,38],[12,38],[15,40],[12,42],[9,44],[6,43],[3,43],[3,42],[0,39],[-1,37],[-5,36],[-9,37]],
+  // Great Britain
+  [[-5,50],[1,51],[2,53],[0,54],[-2,56],[-2,58],[-5,59],[-6,57],[-5,55],[-3,54],[-4,53],[-5,52],[-5,50]],
+  // Ireland
+  [[-10,52],[-6,52],[-6,54],[-8,55],[-10,54],[-10,52]],
+  // Iceland
+  [[-24,65],[-14,66],[-14,64],[-22,63],[-24,65]],
+  // Japan
+  [[130,31],[132,34],[135,34],[140,35],[141,38],[142,41],[140,41],[140,38],[137,37],[133,35],[130,33],[130,31]],
+  [[140,42],[144,43],[145,44],[142,45],[140,43],[140,42]],
+  // Philippines
+  [[120,18],[122,18],[124,12],[126,7],[122,7],[120,14],[120,18]],
+  // Indonesia and New Guinea
+  [[95,5],[98,4],[104,-2],[106,-6],[101,-3],[95,5]],
+  [[109,2],[117,7],[119,1],[116,-4],[110,-3],[109,2]],
+  [[105,-6],[114,-7],[114,-8],[106,-7],[105,-6]],
+  [[131,-1],[141,-2],[150,-10],[141,-9],[138,-8],[131,-1]],
+  // Australia
+  [[114,-22],[114,-34],[118,-35],[124,-34],[131,-31],[136,-35],[138,-35],[140,-38],[146,-39],[150,-37],[153,-32],[153,-25],[150,-22],[146,-19],[145,-15],[142,-11],[141,-17],[136,-15],[137,-12],[132,-11],[129,-15],[125,-14],[122,-18],[114,-22]],
+  // New Zealand
+  [[173,-35],[175,-37],[178,-38],[176,-40],[175,-41],[174,-39],[173,-35]],
+  [[174,-41],[172,-41],[167,-46],[169,-47],[171,-45],[174,-41]]
+];